@@ -0,0 +1,298 @@
+// SPDX-FileCopyrightText: 2026 Sascha Brawer <sascha@brawer.ch>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/brawer/osmviews/v2/geotiff"
+)
+
+// ProbeLocations is a fixed set of places whose ranks get compared
+// between builds. It mixes metropolitan centers, suburbs, small towns
+// and remote places, so that both ends of the ranking are covered.
+var probeLocations = [][2]float64{
+	{35.658514, 139.701330},  // Tokyo, Shibuya
+	{35.710719, 139.801547},  // Tokyo, Sumida
+	{47.391485, 8.488945},    // Zürich, Altstetten
+	{47.358651, 8.590251},    // Zürich, Witikon
+	{-54.794395, -68.251958}, // Ushuaia, Costa Este
+	{-54.769225, -68.279174}, // Ushuaia, Las Reinas
+	{51.507351, -0.127758},   // London, Trafalgar Square
+	{48.858370, 2.294481},    // Paris, Eiffel Tower
+	{40.758896, -73.985130},  // New York, Times Square
+	{-33.856784, 151.215297}, // Sydney, Opera House
+	{-23.550520, -46.633308}, // São Paulo, Sé
+	{19.432608, -99.133209},  // Mexico City, Zócalo
+	{30.044420, 31.235712},   // Cairo, Tahrir Square
+	{-1.292066, 36.821946},   // Nairobi
+	{28.613939, 77.209021},   // New Delhi
+	{55.755826, 37.617300},   // Moscow, Red Square
+	{64.146582, -21.942636},  // Reykjavík
+	{46.946834, 7.444072},    // Bern
+	{46.578411, 8.005300},    // Jungfraujoch
+	{78.223172, 15.626723},   // Longyearbyen
+	{-13.531950, -71.967463}, // Cusco
+	{27.988119, 86.925026},   // Mount Everest
+	{23.416203, 25.662830},   // Sahara, Libyan Desert
+	{-24.776109, 134.755000}, // Australian Outback
+}
+
+// BuildSummary has the figures by which a build gets compared
+// against the previous one.
+type buildSummary struct {
+	TotalViews  float64   // weekly views, estimated from a coarse overview
+	Median      float64   // median weekly views per km², from the stats
+	SharedTiles float64   // fraction of main image tiles with shared data
+	Probes      []float64 // values at probeLocations
+}
+
+// ComparisonLimits tells how much a build may deviate from the
+// previous one before the builder refuses to publish it.
+type comparisonLimits struct {
+	MaxChange      float64 // relative change of total views and median
+	MaxSharedDelta float64 // absolute change of the shared tile fraction
+	MinCorrelation float64 // Spearman rank correlation of probes
+}
+
+// CompareOutputs compares each freshly painted output against the
+// latest earlier version of its product in storage, and returns an
+// error for the first one that deviates by more than the limits allow.
+func compareOutputs(ctx context.Context, s Storage, bucket, workdir string, outputs []*output, limits comparisonLimits) error {
+	for _, out := range outputs {
+		if err := compareWithPrevious(ctx, s, bucket, workdir, out, limits); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CompareWithPrevious compares a freshly painted output against the
+// latest earlier version of the same product in storage, and returns
+// an error if the two deviate by more than the limits allow. If there
+// is no earlier version, there is nothing to compare against.
+func compareWithPrevious(ctx context.Context, s Storage, bucket, workdir string, out *output, limits comparisonLimits) error {
+	logger := log.Default()
+	product := out.product
+	files, err := s.List(ctx, bucket, "public/"+product+"-")
+	if err != nil {
+		return err
+	}
+
+	re := regexp.MustCompile(`^public/` + regexp.QuoteMeta(product) + `-(\d{8})\.tiff$`)
+	prevDate := ""
+	for _, f := range files {
+		if m := re.FindStringSubmatch(f.Key); m != nil && f.Key < out.remotePath && m[1] > prevDate {
+			prevDate = m[1]
+		}
+	}
+	if prevDate == "" {
+		logger.Printf("No previous build of %s in storage, skipping comparison", product)
+		return nil
+	}
+
+	// Trend outputs have no stats file, neither now nor previously.
+	prevPath := filepath.Join(workdir, fmt.Sprintf("previous-%s-%s.tiff", product, prevDate))
+	prevStatsPath := ""
+	if out.remoteStatsPath != "" {
+		prevStatsPath = filepath.Join(workdir, fmt.Sprintf("previous-%s-stats-%s.json", product, prevDate))
+	}
+	for _, f := range []struct{ remote, local string }{
+		{fmt.Sprintf("public/%s-%s.tiff", product, prevDate), prevPath},
+		{fmt.Sprintf("public/%s-stats-%s.json", product, prevDate), prevStatsPath},
+	} {
+		if f.local == "" {
+			continue
+		}
+		defer os.Remove(f.local)
+		if err := Download(s, bucket, f.remote, f.local); err != nil {
+			return err
+		}
+	}
+
+	prev, err := summarizeBuild(prevPath, prevStatsPath)
+	if err != nil {
+		return err
+	}
+	cur, err := summarizeBuild(out.job.Path, out.localStatsPath)
+	if err != nil {
+		return err
+	}
+	logger.Printf("Compared %s against build of %s: total views %.0f (was %.0f), median %g (was %g), shared tiles %.1f%% (was %.1f%%)",
+		out.remotePath, prevDate, cur.TotalViews, prev.TotalViews, cur.Median, prev.Median,
+		100*cur.SharedTiles, 100*prev.SharedTiles)
+	if err := cur.compare(prev, limits); err != nil {
+		return fmt.Errorf("%s deviates too much from build of %s: %w", out.remotePath, prevDate, err)
+	}
+	return nil
+}
+
+// SummarizeBuild computes a buildSummary from a GeoTIFF and the stats
+// file that BuildStats has computed for it. Trend files have no stats
+// file, so statsPath is empty; since their pixels are signed log ratios
+// instead of view densities, their summary has no total views and no
+// median, which are zero and therefore never change.
+func summarizeBuild(tiffPath, statsPath string) (*buildSummary, error) {
+	f, err := os.Open(tiffPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r, err := geotiff.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &buildSummary{Probes: make([]float64, len(probeLocations))}
+	for i, p := range probeLocations {
+		val, err := r.ValueAt(p[0], p[1], 255)
+		if err != nil {
+			return nil, err
+		}
+		s.Probes[i] = float64(val)
+	}
+
+	main := r.Images[0]
+	shared := findSharedTiles(main.TileOffsets)
+	numShared := 0
+	for _, st := range shared {
+		numShared += st.UseCount
+	}
+	s.SharedTiles = float64(numShared) / float64(len(main.TileOffsets))
+
+	if statsPath == "" {
+		return s, nil
+	}
+
+	// Summing up the views of all pixels in the main image would take
+	// too long, so we estimate the total from an overview. Depending
+	// on the resampling, this overstates the views, but in the same
+	// way for every build.
+	// Since most tiles share their data with others, we decompress
+	// each distinct tile once, and remember the sums of its rows.
+	img := r.ImageAt(10)
+	zoom := img.Zoom()
+	tw, th := img.TileWidth, img.TileHeight
+	pixels := make([]float32, tw*th)
+	rowSums := make(map[uint64][]float64, 16)
+	for tile, offset := range img.TileOffsets {
+		sums, ok := rowSums[offset]
+		if !ok {
+			if err := img.ReadBand(tile, 0, pixels); err != nil {
+				return nil, err
+			}
+			sums = make([]float64, th)
+			for i, val := range pixels {
+				sums[uint32(i)/tw] += math.Expm1(float64(val))
+			}
+			rowSums[offset] = sums
+		}
+		top := uint32(tile/img.TilesAcross()) * th
+		for py, sum := range sums {
+			if y := top + uint32(py); y < img.Height {
+				s.TotalViews += sum * TileArea(zoom, y)
+			}
+		}
+	}
+
+	data, err := os.ReadFile(statsPath)
+	if err != nil {
+		return nil, err
+	}
+	var stats Stats
+	if err := json.Unmarshal(data, &stats); err != nil {
+		return nil, err
+	}
+	if stats.Median < 0 || stats.Median >= len(stats.Samples) || len(stats.Samples[stats.Median]) < 3 {
+		return nil, fmt.Errorf("%s: bad median", statsPath)
+	}
+	median, ok := stats.Samples[stats.Median][2].(float64)
+	if !ok {
+		return nil, fmt.Errorf("%s: bad median", statsPath)
+	}
+	s.Median = median
+
+	return s, nil
+}
+
+// Compare returns an error if s deviates from the summary of the
+// previous build by more than the limits allow.
+func (s *buildSummary) compare(prev *buildSummary, limits comparisonLimits) error {
+	change := func(a, b float64) float64 {
+		if a == b {
+			return 0
+		}
+		if b == 0 {
+			return math.Inf(1)
+		}
+		return math.Abs(a-b) / b
+	}
+	if c := change(s.TotalViews, prev.TotalViews); c > limits.MaxChange {
+		return fmt.Errorf("total views changed by %.1f%%, from %.0f to %.0f", 100*c, prev.TotalViews, s.TotalViews)
+	}
+	if c := change(s.Median, prev.Median); c > limits.MaxChange {
+		return fmt.Errorf("median changed by %.1f%%, from %g to %g", 100*c, prev.Median, s.Median)
+	}
+	if d := math.Abs(s.SharedTiles - prev.SharedTiles); d > limits.MaxSharedDelta {
+		return fmt.Errorf("shared tiles changed from %.1f%% to %.1f%%", 100*prev.SharedTiles, 100*s.SharedTiles)
+	}
+	if c := spearman(s.Probes, prev.Probes); c < limits.MinCorrelation {
+		return fmt.Errorf("rank correlation of probe locations is %.3f, want at least %.3f", c, limits.MinCorrelation)
+	}
+	return nil
+}
+
+// Spearman returns the Spearman rank correlation coefficient of two
+// equally long series. Tied values get the mean of their ranks.
+func spearman(a, b []float64) float64 {
+	ra, rb := ranks(a), ranks(b)
+	n := float64(len(a))
+	meanRank := (n + 1) / 2
+	var cov, varA, varB float64
+	for i := range ra {
+		da, db := ra[i]-meanRank, rb[i]-meanRank
+		cov += da * db
+		varA += da * da
+		varB += db * db
+	}
+	if varA == 0 || varB == 0 {
+		if varA == varB {
+			return 1 // both constant
+		}
+		return 0
+	}
+	return cov / math.Sqrt(varA*varB)
+}
+
+// Ranks returns the ranks of values, starting at 1.
+func ranks(values []float64) []float64 {
+	order := make([]int, len(values))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return values[order[i]] < values[order[j]] })
+
+	result := make([]float64, len(values))
+	for start := 0; start < len(order); {
+		end := start + 1
+		for end < len(order) && values[order[end]] == values[order[start]] {
+			end++
+		}
+		rank := float64(start+end+1) / 2 // mean of ranks start+1..end
+		for _, i := range order[start:end] {
+			result[i] = rank
+		}
+		start = end
+	}
+	return result
+}
@@ -0,0 +1,244 @@
+// SPDX-FileCopyrightText: 2026 Sascha Brawer <sascha@brawer.ch>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/brawer/osmviews/v2/geotiff"
+)
+
+func TestSpearman(t *testing.T) {
+	for _, tc := range []struct {
+		a, b []float64
+		want float64
+	}{
+		{[]float64{1, 2, 3, 4}, []float64{10, 20, 30, 40}, 1},
+		{[]float64{1, 2, 3, 4}, []float64{4, 3, 2, 1}, -1},
+		{[]float64{1, 2, 3, 4, 5}, []float64{2, 1, 4, 3, 5}, 0.8},
+		{[]float64{1, 1, 2, 3}, []float64{5, 5, 6, 7}, 1},
+		{[]float64{0, 0, 0}, []float64{0, 0, 0}, 1},
+		{[]float64{0, 0, 0}, []float64{1, 2, 3}, 0},
+	} {
+		if got := spearman(tc.a, tc.b); math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("spearman(%v, %v): got %f, want %f", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestRanks(t *testing.T) {
+	got := ranks([]float64{30, 10, 20, 10})
+	want := []float64{4, 1.5, 3, 1.5}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got %v, want %v", got, want)
+			break
+		}
+	}
+}
+
+func TestBuildSummary_compare(t *testing.T) {
+	limits := comparisonLimits{MaxChange: 0.25, MaxSharedDelta: 0.05, MinCorrelation: 0.8}
+	prev := buildSummary{
+		TotalViews:  1000,
+		Median:      10,
+		SharedTiles: 0.5,
+		Probes:      []float64{1, 2, 3, 4, 5},
+	}
+	if err := prev.compare(&prev, limits); err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+
+	views, median, shared, probes, zero := prev, prev, prev, prev, prev
+	zero.Median = 0
+	if err := zero.compare(&zero, limits); err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+	views.TotalViews = 500
+	median.Median = 13
+	shared.SharedTiles = 0.6
+	probes.Probes = []float64{5, 4, 3, 2, 1}
+	for _, tc := range []struct {
+		s    buildSummary
+		want string
+	}{
+		{views, "total views changed by 50.0%, from 1000 to 500"},
+		{median, "median changed by 30.0%, from 10 to 13"},
+		{shared, "shared tiles changed from 50.0% to 60.0%"},
+		{probes, "rank correlation of probe locations is -1.000, want at least 0.800"},
+	} {
+		got := ""
+		if err := tc.s.compare(&prev, limits); err != nil {
+			got = err.Error()
+		}
+		if got != tc.want {
+			t.Errorf("got %q, want %q", got, tc.want)
+		}
+	}
+}
+
+// WriteCompareFixture places a small world GeoTIFF and a hand-written
+// stats file into dir, named like the outputs of newOutput.
+func writeCompareFixture(t *testing.T, dir, product string) *output {
+	out, err := newOutput(dir, product, []string{"2021-W47"}, 0, 1, Median)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tiff, err := os.ReadFile(filepath.Join("..", "..", "geotiff", "testdata", "zurich_f32.tiff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(out.job.Path, tiff, 0644); err != nil {
+		t.Fatal(err)
+	}
+	stats := `{"Median":1,"Samples":[[[47.37,8.54],1,812.5],[[47.39,8.49],7,12.25],[[46.95,7.44],20,1]]}`
+	if err := os.WriteFile(out.localStatsPath, []byte(stats), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestSummarizeBuild(t *testing.T) {
+	out := writeCompareFixture(t, t.TempDir(), "osmviews")
+	summary, err := summarizeBuild(out.job.Path, out.localStatsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Median != 12.25 {
+		t.Errorf("got Median=%g, want 12.25", summary.Median)
+	}
+	if summary.TotalViews <= 0 || summary.SharedTiles < 0 || summary.SharedTiles > 1 {
+		t.Errorf("got %+v, want positive TotalViews and SharedTiles in [0, 1]", summary)
+	}
+	if len(summary.Probes) != len(probeLocations) {
+		t.Errorf("got %d probes, want %d", len(summary.Probes), len(probeLocations))
+	}
+
+	// Check the total views against a straightforward computation.
+	f, err := os.Open(out.job.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := geotiff.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := r.ImageAt(10)
+	pixels := make([]float32, img.Width*img.Height)
+	if err := img.ReadWindow(0, 0, img.Width, img.Height, 0, pixels); err != nil {
+		t.Fatal(err)
+	}
+	var want float64
+	for i, val := range pixels {
+		y := uint32(i) / img.Width
+		want += math.Expm1(float64(val)) * TileArea(img.Zoom(), y)
+	}
+	if math.Abs(summary.TotalViews-want) > 1e-6*want {
+		t.Errorf("got TotalViews=%f, want %f", summary.TotalViews, want)
+	}
+}
+
+func TestCompareWithPrevious(t *testing.T) {
+	dir := t.TempDir()
+	out := writeCompareFixture(t, dir, "osmviews")
+
+	ctx := context.Background()
+	limits := comparisonLimits{MaxChange: 0.25, MaxSharedDelta: 0.05, MinCorrelation: 0.8}
+	s := NewFakeStorage()
+	if err := compareWithPrevious(ctx, s, "bucket", dir, out, limits); err != nil {
+		t.Errorf("without previous build: got %v, want nil", err)
+	}
+
+	// Pretend that an identical build had been published a week earlier.
+	// Later builds, and builds of other products, must not be used.
+	junk := filepath.Join(t.TempDir(), "junk")
+	if err := os.WriteFile(junk, []byte("junk"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []struct{ remote, local string }{
+		{"public/osmviews-20211121.tiff", out.job.Path},
+		{"public/osmviews-stats-20211121.json", out.localStatsPath},
+		{"public/osmviews-20211205.tiff", junk},
+		{"public/osmviews-z12-20211121.tiff", junk},
+	} {
+		if err := s.PutFile(ctx, "bucket", f.remote, f.local, "image/tiff"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := compareWithPrevious(ctx, s, "bucket", dir, out, limits); err != nil {
+		t.Errorf("with identical previous build: got %v, want nil", err)
+	}
+
+	// A build whose median has doubled must not get published.
+	doubled := `{"Median":1,"Samples":[[[47.37,8.54],1,812.5],[[47.39,8.49],7,24.5],[[46.95,7.44],20,1]]}`
+	if err := os.WriteFile(out.localStatsPath, []byte(doubled), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := compareWithPrevious(ctx, s, "bucket", dir, out, limits)
+	if err == nil || !strings.Contains(err.Error(), "deviates too much from build of 20211121: median changed by 100.0%") {
+		t.Errorf("with doubled median: got %v, want deviation error", err)
+	}
+}
+
+// Besides the main output, the companion and the trend must be
+// compared against their previous versions as well.
+func TestCompareOutputs(t *testing.T) {
+	dir := t.TempDir()
+	primary := writeCompareFixture(t, dir, "osmviews")
+	companion := writeCompareFixture(t, dir, "osmviews-z12")
+	trend := writeCompareFixture(t, dir, "osmviews-trend-13w")
+	os.Remove(trend.localStatsPath)
+	trend.localStatsPath, trend.localStatsPlotPath, trend.remoteStatsPath = "", "", ""
+	outputs := []*output{primary, companion, trend}
+
+	// The trend has no stats, neither now nor in its previous build.
+	ctx := context.Background()
+	limits := comparisonLimits{MaxChange: 0.25, MaxSharedDelta: 0.05, MinCorrelation: 0.8}
+	s := NewFakeStorage()
+	for _, f := range []struct{ remote, local string }{
+		{"public/osmviews-20211121.tiff", primary.job.Path},
+		{"public/osmviews-stats-20211121.json", primary.localStatsPath},
+		{"public/osmviews-z12-20211121.tiff", companion.job.Path},
+		{"public/osmviews-z12-stats-20211121.json", companion.localStatsPath},
+		{"public/osmviews-trend-13w-20211121.tiff", trend.job.Path},
+	} {
+		if err := s.PutFile(ctx, "bucket", f.remote, f.local, "image/tiff"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := compareOutputs(ctx, s, "bucket", dir, outputs, limits); err != nil {
+		t.Errorf("with identical previous builds: got %v, want nil", err)
+	}
+
+	// A companion whose median has doubled must not get published,
+	// even if the main output is fine.
+	doubled := `{"Median":1,"Samples":[[[47.37,8.54],1,812.5],[[47.39,8.49],7,24.5],[[46.95,7.44],20,1]]}`
+	if err := os.WriteFile(companion.localStatsPath, []byte(doubled), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := compareOutputs(ctx, s, "bucket", dir, outputs, limits)
+	if err == nil || !strings.Contains(err.Error(), "public/osmviews-z12-20211128.tiff deviates too much") {
+		t.Errorf("with doubled companion median: got %v, want deviation error", err)
+	}
+}
+
+func TestSummarizeBuild_Trend(t *testing.T) {
+	out := writeCompareFixture(t, t.TempDir(), "osmviews-trend-13w")
+	summary, err := summarizeBuild(out.job.Path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.TotalViews != 0 || summary.Median != 0 {
+		t.Errorf("got %+v, want no TotalViews and no Median", summary)
+	}
+	if len(summary.Probes) != len(probeLocations) {
+		t.Errorf("got %d probes, want %d", len(summary.Probes), len(probeLocations))
+	}
+}
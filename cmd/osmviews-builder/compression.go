@@ -0,0 +1,81 @@
+// SPDX-FileCopyrightText: 2026 Sascha Brawer <sascha@brawer.ch>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is a scheme for compressing the tiles of output TIFF
+// files. Its value is the code for the TIFF Compression tag.
+type Compression uint16
+
+const (
+	// Deflate is zlib compression, which every TIFF reader supports.
+	Deflate Compression = 8
+
+	// Zstd is Zstandard compression, which GDAL supports since
+	// version 2.3. Compared to Deflate, it decompresses much faster.
+	Zstd Compression = 50000
+
+	// Lerc is lossy LERC compression, which recent versions of GDAL
+	// can read. The decoded samples differ from the original ones
+	// by at most a configurable maximum error; see encodeLerc.
+	Lerc Compression = 34887
+)
+
+// ParseCompression returns the Compression for a name such as
+// "deflate", "zstd" or "lerc".
+func ParseCompression(name string) (Compression, error) {
+	switch name {
+	case "deflate":
+		return Deflate, nil
+	case "zstd":
+		return Zstd, nil
+	case "lerc":
+		return Lerc, nil
+	}
+	return Deflate, fmt.Errorf("unknown compression: %q", name)
+}
+
+func (c Compression) String() string {
+	switch c {
+	case Deflate:
+		return "deflate"
+	case Zstd:
+		return "zstd"
+	case Lerc:
+		return "lerc"
+	}
+	return fmt.Sprintf("Compression(%d)", uint16(c))
+}
+
+// ZstdEncoder is shared by all RasterWriters; its EncodeAll method
+// can be called concurrently.
+var zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedBestCompression))
+
+// Compress appends the compressed form of data to buf. LERC works
+// on samples instead of bytes, so it is handled by the RasterWriter.
+func (c Compression) compress(buf *bytes.Buffer, data []byte) error {
+	switch c {
+	case Deflate:
+		writer, err := zlib.NewWriterLevel(buf, zlib.BestCompression)
+		if err != nil {
+			return err
+		}
+		if _, err := writer.Write(data); err != nil {
+			return err
+		}
+		return writer.Close()
+
+	case Zstd:
+		buf.Write(zstdEncoder.EncodeAll(data, nil))
+		return nil
+	}
+	return fmt.Errorf("unsupported compression: %s", c)
+}
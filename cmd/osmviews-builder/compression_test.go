@@ -0,0 +1,28 @@
+// SPDX-FileCopyrightText: 2026 Sascha Brawer <sascha@brawer.ch>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"testing"
+)
+
+func TestParseCompression(t *testing.T) {
+	for _, name := range []string{"deflate", "zstd", "lerc"} {
+		c, err := ParseCompression(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := c.String(); got != name {
+			t.Errorf("got %q, want %q", got, name)
+		}
+	}
+}
+
+func TestParseCompression_Invalid(t *testing.T) {
+	for _, name := range []string{"", "zlib", "ZSTD", "LERC"} {
+		if _, err := ParseCompression(name); err == nil {
+			t.Errorf("ParseCompression(%q) should fail", name)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// SPDX-FileCopyrightText: 2026 Sascha Brawer <sascha@brawer.ch>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"sync"
+)
+
+// Compressor compresses the tiles of a RasterWriter on a pool of worker
+// goroutines, so that painting does not need to wait for compression.
+// The compressed tiles get appended to the temporary file in the same
+// order as they were submitted, so the output is the same no matter
+// how many workers are running.
+type compressor struct {
+	tasks chan *compressTask // to workers
+	order chan *compressTask // to the goroutine writing the temp file
+	done  chan struct{}
+
+	mu  sync.Mutex
+	err error
+}
+
+type compressTask struct {
+	zoom      uint8
+	tileIndex uint32
+	samples   []float32
+	data      []byte
+	err       error
+	ready     chan struct{}
+}
+
+// SharedTile is a tile whose data is the same as that of another
+// tile at the same zoom level, which has been submitted earlier.
+// Since the other tile may not yet have been written to the temporary
+// file, its offset gets copied when the RasterWriter is closed.
+type sharedTile struct {
+	zoom       uint8
+	tile, same uint32
+}
+
+func (w *RasterWriter) startCompressor(numWorkers int) *compressor {
+	c := &compressor{
+		tasks: make(chan *compressTask, numWorkers),
+		order: make(chan *compressTask, 2*numWorkers),
+		done:  make(chan struct{}),
+	}
+	for i := 0; i < numWorkers; i++ {
+		go func() {
+			for t := range c.tasks {
+				t.data, t.err = w.encode(t.samples)
+				t.samples = nil
+				close(t.ready)
+			}
+		}()
+	}
+	go func() {
+		defer close(c.done)
+		for t := range c.order {
+			<-t.ready
+			if c.error() != nil {
+				continue // keep draining, so submit never blocks
+			}
+			err := t.err
+			if err == nil {
+				err = w.appendTile(t)
+			}
+			if err != nil {
+				c.mu.Lock()
+				c.err = err
+				c.mu.Unlock()
+			}
+		}
+	}()
+	return c
+}
+
+var errAborted = errors.New("compression aborted")
+
+func (c *compressor) error() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Submit schedules the samples of a tile for compression. Because this
+// happens in the background, the caller must not modify them afterwards.
+// Errors may be reported by a later call, or by flush.
+func (w *RasterWriter) submit(tile TileKey, samples []float32) error {
+	if w.compressor == nil {
+		w.compressor = w.startCompressor(runtime.GOMAXPROCS(0))
+	}
+	if err := w.compressor.error(); err != nil {
+		return err
+	}
+
+	zoom, x, y := tile.ZoomXY()
+	t := &compressTask{
+		zoom:      zoom,
+		tileIndex: (1<<zoom)*y + x,
+		samples:   samples,
+		ready:     make(chan struct{}),
+	}
+	w.compressor.order <- t
+	w.compressor.tasks <- t
+	return nil
+}
+
+// AppendTile writes a compressed tile to the temporary file.
+func (w *RasterWriter) appendTile(t *compressTask) error {
+	n, err := w.tempFile.Write(t.data)
+	if err != nil {
+		return err
+	}
+	w.tileOffsets[t.zoom][t.tileIndex] = w.tempFileSize
+	w.tileByteCounts[t.zoom][t.tileIndex] = uint32(n)
+	w.tempFileSize += uint64(n)
+	return nil
+}
+
+// Share records that a tile has the same data as another tile.
+func (w *RasterWriter) share(zoom uint8, tile, same uint32) {
+	w.sharedTiles = append(w.sharedTiles, sharedTile{zoom, tile, same})
+}
+
+// Flush waits until all submitted tiles have been written to the
+// temporary file, and then fills in the offsets of shared tiles.
+func (w *RasterWriter) flush() error {
+	if c := w.compressor; c != nil {
+		close(c.tasks)
+		close(c.order)
+		<-c.done
+		w.compressor = nil
+		if err := c.error(); err != nil {
+			return err
+		}
+	}
+	for _, s := range w.sharedTiles {
+		w.tileOffsets[s.zoom][s.tile] = w.tileOffsets[s.zoom][s.same]
+		w.tileByteCounts[s.zoom][s.tile] = w.tileByteCounts[s.zoom][s.same]
+	}
+	w.sharedTiles = nil
+	return nil
+}
+
+// Abort stops the compression workers and removes the temporary files,
+// without producing any output. It gets called when painting fails
+// partway, so that no goroutines are left behind. Calling abort on
+// a writer that has already been closed has no effect.
+func (w *RasterWriter) abort() {
+	if c := w.compressor; c != nil {
+		// Setting an error makes the goroutine for the temporary file
+		// drain the remaining tasks without writing them.
+		c.mu.Lock()
+		if c.err == nil {
+			c.err = errAborted
+		}
+		c.mu.Unlock()
+		close(c.tasks)
+		close(c.order)
+		<-c.done
+		w.compressor = nil
+	}
+	if w.tempFile != nil {
+		w.tempFile.Close()
+		os.Remove(w.tempFile.Name())
+		w.tempFile = nil
+		os.Remove(w.path + ".tmp")
+	}
+}
@@ -0,0 +1,97 @@
+// SPDX-FileCopyrightText: 2026 Sascha Brawer <sascha@brawer.ch>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The output must not depend on the number of compression workers.
+func TestCompressor_Deterministic(t *testing.T) {
+	dir := t.TempDir()
+	var outputs [][]byte
+	for _, numWorkers := range []int{1, 4} {
+		path := filepath.Join(dir, "out.tif")
+		w, err := NewRasterWriter(path, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.compressor = w.startCompressor(numWorkers)
+		for zoom := uint8(0); zoom <= 2; zoom++ {
+			for y := uint32(0); y < 1<<zoom; y++ {
+				for x := uint32(0); x < 1<<zoom; x++ {
+					tile := MakeTileKey(zoom, x, y)
+					if x == 0 {
+						if err := w.WriteUniform(tile, uint32(zoom)); err != nil {
+							t.Fatal(err)
+						}
+						continue
+					}
+					r := &Raster{tile: tile}
+					for i := range r.pixels {
+						r.pixels[i] = float32((i*int(x+7*y+1))%1009) / 10
+					}
+					if err := w.Write(r); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		outputs = append(outputs, data)
+	}
+	if !bytes.Equal(outputs[0], outputs[1]) {
+		t.Errorf("output differs between 1 and 4 workers")
+	}
+}
+
+// When painting fails partway, the compression workers must stop,
+// and the temporary files must be removed.
+func TestCompressor_Abort(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+	before := runtime.NumGoroutine()
+
+	// Painting tile 9/300/300 emits the raster for tile 1/0/0,
+	// which starts the compressor; the repeated tile then fails.
+	readers := []io.Reader{strings.NewReader("9/0/0 5000\n9/300/300 5\n9/400/400 5\n9/400/400 6\n")}
+	jobs := []PaintJob{
+		{Path: filepath.Join(dir, "a.tif"), FirstWeek: 0, LimitWeek: 1, Statistic: Median},
+		{Path: filepath.Join(dir, "b.tif"), FirstWeek: 0, LimitWeek: 1, Statistic: Median, AuxBands: true},
+	}
+	if err := paintJobs(jobs, 9, readers, []string{"2021-W47"}, context.Background()); err == nil {
+		t.Fatal("want error for repeated tile")
+	}
+
+	// The workers exit after the tasks channel has been closed,
+	// but not necessarily before paintJobs returns.
+	for deadline := time.Now().Add(5 * time.Second); runtime.NumGoroutine() > before; {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d goroutines after failure, want %d", runtime.NumGoroutine(), before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		t.Errorf("got leftover file %s", f.Name())
+	}
+}
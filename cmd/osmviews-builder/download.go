@@ -0,0 +1,195 @@
+// SPDX-FileCopyrightText: 2026 Sascha Brawer <sascha@brawer.ch>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// MaxDownloadAttempts is how often we try to fetch a file over HTTP
+// before giving up.
+const maxDownloadAttempts = 8
+
+// DownloadBackoff is the delay before the second attempt to fetch
+// a file over HTTP. For each further attempt, the delay gets doubled.
+var downloadBackoff = 2 * time.Second
+
+// StallTimeout is how long a transfer may go without receiving any
+// data before we break it off, so that the next attempt can resume.
+var stallTimeout = 2 * time.Minute
+
+// NewHTTPClient returns a client for fetching files from the web.
+// Unlike the default client, it gives up on servers that do not accept
+// connections or do not answer. Because the daily tile logs are large,
+// there is no limit on the duration of an entire request; stalled
+// transfers get handled by downloadURL.
+func NewHTTPClient() *http.Client {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   30 * time.Second,
+		ResponseHeaderTimeout: 2 * time.Minute,
+		IdleConnTimeout:       90 * time.Second,
+	}
+	return &http.Client{Transport: transport}
+}
+
+// DownloadURL fetches url into a file at path. If the file already
+// exists, nothing gets fetched. Failed attempts are retried with
+// exponential backoff; if a transfer breaks off in the middle, the next
+// attempt requests the missing rest with an HTTP Range header, which is
+// kept in a temporary file next to path until the download is complete.
+func downloadURL(ctx context.Context, client *http.Client, url, path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	logger := log.Default()
+	partPath := path + ".part"
+	backoff := downloadBackoff
+	var err error
+	for attempt := 1; attempt <= maxDownloadAttempts; attempt++ {
+		if attempt > 1 {
+			logger.Printf("fetching %s failed, retrying in %v: %v", url, backoff, err)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+
+		var retry bool
+		retry, err = downloadAttempt(ctx, client, url, partPath)
+		if err == nil {
+			return os.Rename(partPath, path)
+		}
+		if !retry || ctx.Err() != nil {
+			break
+		}
+	}
+	return fmt.Errorf("failed to fetch %s: %w", url, err)
+}
+
+var contentRangeRegexp = regexp.MustCompile(`^bytes (?:(\d+)-\d+|\*)/(\d+)$`)
+
+// DownloadAttempt makes a single attempt at fetching url, appending
+// to whatever an earlier attempt has left in the file at partPath.
+// If the attempt fails, the result tells whether to try again.
+func downloadAttempt(ctx context.Context, client *http.Client, url, partPath string) (retry bool, err error) {
+	out, err := os.OpenFile(partPath, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return false, err
+	}
+	defer out.Close()
+
+	offset, err := out.Seek(0, io.SeekEnd)
+	if err != nil {
+		return false, err
+	}
+
+	// Cancel the request if no data arrives for too long.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	watchdog := time.AfterFunc(stallTimeout, cancel)
+	defer watchdog.Stop()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	// With a Range request, the server may either send the missing
+	// rest of the file, or ignore the header and send the entire file.
+	// If we already have the entire file, it tells so with status 416.
+	size := int64(-1)
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if offset > 0 {
+			if err := out.Truncate(0); err != nil {
+				return false, err
+			}
+			if offset, err = out.Seek(0, io.SeekStart); err != nil {
+				return false, err
+			}
+		}
+		size = resp.ContentLength
+
+	case http.StatusPartialContent, http.StatusRequestedRangeNotSatisfiable:
+		m := contentRangeRegexp.FindStringSubmatch(resp.Header.Get("Content-Range"))
+		if m == nil {
+			return true, fmt.Errorf("bad Content-Range: %q", resp.Header.Get("Content-Range"))
+		}
+		size, _ = strconv.ParseInt(m[2], 10, 64)
+		if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+			if size == offset {
+				return false, nil
+			}
+			// Our partial file is longer than the file on the server,
+			// which must have changed. Start over.
+			if err := out.Truncate(0); err != nil {
+				return false, err
+			}
+			return true, fmt.Errorf("have %d bytes, but server has %d", offset, size)
+		}
+		if start, _ := strconv.ParseInt(m[1], 10, 64); m[1] == "" || start != offset {
+			if err := out.Truncate(0); err != nil {
+				return false, err
+			}
+			return true, fmt.Errorf("asked for bytes from %d, got %q", offset, resp.Header.Get("Content-Range"))
+		}
+
+	case http.StatusTooManyRequests:
+		return true, fmt.Errorf("StatusCode=%d", resp.StatusCode)
+
+	default:
+		return resp.StatusCode >= 500, fmt.Errorf("StatusCode=%d", resp.StatusCode)
+	}
+
+	body := &watchedReader{resp.Body, watchdog}
+	n, err := io.Copy(out, body)
+	if err != nil {
+		return true, err
+	}
+	if size >= 0 && offset+n != size {
+		return true, fmt.Errorf("got %d bytes, want %d", offset+n, size)
+	}
+	if err := out.Sync(); err != nil {
+		return false, err
+	}
+	return false, out.Close()
+}
+
+// WatchedReader resets a watchdog timer whenever it receives data.
+type watchedReader struct {
+	r        io.Reader
+	watchdog *time.Timer
+}
+
+func (w *watchedReader) Read(p []byte) (int, error) {
+	n, err := w.r.Read(p)
+	if n > 0 {
+		w.watchdog.Reset(stallTimeout)
+	}
+	return n, err
+}
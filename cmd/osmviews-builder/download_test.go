@@ -0,0 +1,160 @@
+// SPDX-FileCopyrightText: 2026 Sascha Brawer <sascha@brawer.ch>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A fake HTTP transport that serves a single file, supports Range
+// requests, and misbehaves in the ways listed in Failures.
+type FlakyServer struct {
+	Content  []byte
+	Failures []string // "503", "404", "truncate", "stall", "ignore-range"
+	Ranges   []string // Range headers of all requests received
+}
+
+func (f *FlakyServer) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.Ranges = append(f.Ranges, req.Header.Get("Range"))
+	failure := ""
+	if len(f.Failures) > 0 {
+		failure, f.Failures = f.Failures[0], f.Failures[1:]
+	}
+
+	header := make(http.Header)
+	switch failure {
+	case "503":
+		return &http.Response{StatusCode: 503, Header: header, Body: io.NopCloser(strings.NewReader(""))}, nil
+	case "404":
+		return &http.Response{StatusCode: 404, Header: header, Body: io.NopCloser(strings.NewReader(""))}, nil
+	}
+
+	status, start := 200, 0
+	if r := req.Header.Get("Range"); r != "" && failure != "ignore-range" {
+		fmt.Sscanf(r, "bytes=%d-", &start)
+		status = 206
+		header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(f.Content)-1, len(f.Content)))
+	}
+	data := f.Content[start:]
+	var body io.Reader = bytes.NewReader(data)
+	switch failure {
+	case "truncate":
+		body = io.MultiReader(bytes.NewReader(data[:len(data)/2]), &failingReader{})
+	case "stall":
+		body = io.MultiReader(bytes.NewReader(data[:len(data)/2]), &stallingReader{req.Context()})
+	}
+	return &http.Response{
+		StatusCode:    status,
+		Header:        header,
+		Body:          io.NopCloser(body),
+		ContentLength: int64(len(data)),
+	}, nil
+}
+
+type failingReader struct{}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	return 0, io.ErrUnexpectedEOF
+}
+
+type stallingReader struct{ ctx context.Context }
+
+func (r *stallingReader) Read(p []byte) (int, error) {
+	<-r.ctx.Done()
+	return 0, r.ctx.Err()
+}
+
+func setDownloadTimeouts(t *testing.T, backoff, stall time.Duration) {
+	oldBackoff, oldStall := downloadBackoff, stallTimeout
+	downloadBackoff, stallTimeout = backoff, stall
+	t.Cleanup(func() { downloadBackoff, stallTimeout = oldBackoff, oldStall })
+}
+
+func TestDownloadURL(t *testing.T) {
+	setDownloadTimeouts(t, time.Millisecond, 100*time.Millisecond)
+	content := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	for _, tc := range []struct {
+		failures []string
+		ranges   string
+	}{
+		{nil, `[""]`},
+		{[]string{"503", "503"}, `["" "" ""]`},
+		{[]string{"truncate"}, `["" "bytes=18-"]`},
+		{[]string{"stall", "truncate"}, `["" "bytes=18-" "bytes=27-"]`},
+		{[]string{"truncate", "ignore-range"}, `["" "bytes=18-"]`},
+	} {
+		server := &FlakyServer{Content: content, Failures: tc.failures}
+		client := &http.Client{Transport: server}
+		path := filepath.Join(t.TempDir(), "file.txt")
+		if err := downloadURL(context.Background(), client, "https://example.org/file.txt", path); err != nil {
+			t.Errorf("%v: %v", tc.failures, err)
+			continue
+		}
+		if got := fmt.Sprintf("%q", server.Ranges); got != tc.ranges {
+			t.Errorf("%v: got ranges %s, want %s", tc.failures, got, tc.ranges)
+		}
+		if got, err := os.ReadFile(path); err != nil || !bytes.Equal(got, content) {
+			t.Errorf("%v: got %q, want %q", tc.failures, got, content)
+		}
+		if _, err := os.Stat(path + ".part"); !os.IsNotExist(err) {
+			t.Errorf("%v: partial file not cleaned up", tc.failures)
+		}
+	}
+}
+
+func TestDownloadURL_NotFound(t *testing.T) {
+	setDownloadTimeouts(t, time.Millisecond, time.Minute)
+	server := &FlakyServer{Content: []byte("foo"), Failures: []string{"404"}}
+	client := &http.Client{Transport: server}
+	path := filepath.Join(t.TempDir(), "file.txt")
+	err := downloadURL(context.Background(), client, "https://example.org/file.txt", path)
+	if err == nil || !strings.Contains(err.Error(), "StatusCode=404") {
+		t.Errorf("got %v, want error with StatusCode=404", err)
+	}
+	if len(server.Ranges) != 1 {
+		t.Errorf("got %d requests, want 1", len(server.Ranges))
+	}
+}
+
+func TestDownloadURL_GiveUp(t *testing.T) {
+	setDownloadTimeouts(t, time.Millisecond, time.Minute)
+	failures := make([]string, maxDownloadAttempts)
+	for i := range failures {
+		failures[i] = "503"
+	}
+	server := &FlakyServer{Content: []byte("foo"), Failures: failures}
+	client := &http.Client{Transport: server}
+	path := filepath.Join(t.TempDir(), "file.txt")
+	err := downloadURL(context.Background(), client, "https://example.org/file.txt", path)
+	if err == nil || !strings.Contains(err.Error(), "StatusCode=503") {
+		t.Errorf("got %v, want error with StatusCode=503", err)
+	}
+	if len(server.Ranges) != maxDownloadAttempts {
+		t.Errorf("got %d requests, want %d", len(server.Ranges), maxDownloadAttempts)
+	}
+}
+
+func TestDownloadURL_Cached(t *testing.T) {
+	server := &FlakyServer{Content: []byte("new")}
+	client := &http.Client{Transport: server}
+	path := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := downloadURL(context.Background(), client, "https://example.org/file.txt", path); err != nil {
+		t.Fatal(err)
+	}
+	if len(server.Ranges) != 0 {
+		t.Errorf("got %d requests, want 0", len(server.Ranges))
+	}
+}
@@ -15,14 +15,14 @@ type SharedTile struct {
 	SampleTiles []TileIndex // A random sample of tiles that share this data.
 }
 
-type SharedTiles map[uint32]*SharedTile
+type SharedTiles map[uint64]*SharedTile
 
 // FindSharedTiles detects shared tiles from an array of tile offsets
 // in a TIFF image. In our GeoTIFFs, about 93.1% of all tile offsets
 // are getting shared. Typically these tiles are for deserts or oceans.
-func findSharedTiles(tileOffsets []uint32) SharedTiles {
+func findSharedTiles(tileOffsets []uint64) SharedTiles {
 	shared := make(SharedTiles, 20)     // 16 for GeoTIFF of 2022-01-24
-	uses := make(map[uint32]int, 80000) // 72138 for TIFF of 2022-01-24
+	uses := make(map[uint64]int, 80000) // 72138 for TIFF of 2022-01-24
 	for _, off := range tileOffsets {
 		uses[off] += 1
 	}
@@ -9,7 +9,7 @@ import (
 
 func TestFindSharedTiles(t *testing.T) {
 	// Tiles 1 and 3 share the same data offset.
-	shared := findSharedTiles([]uint32{12, 72, 88, 72, 32, 18})
+	shared := findSharedTiles([]uint64{12, 72, 88, 72, 32, 18})
 	if len(shared) != 1 {
 		t.Fatalf("want len(shared) == 1, got %d", len(shared))
 	}
@@ -0,0 +1,228 @@
+// SPDX-FileCopyrightText: 2026 Sascha Brawer <sascha@brawer.ch>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"math/bits"
+	"slices"
+)
+
+// LERC (Limited Error Raster Compression) is a lossy compression scheme
+// for rasters, where the encoder guarantees that no decoded sample
+// differs from the original by more than a given maximum error.
+// We write version 4 of the Lerc2 blob format, which is also what
+// libtiff writes for GDAL; its samples are quantized in blocks
+// of 8×8 pixels, and the quantized values get bit-stuffed.
+// https://github.com/Esri/lerc/blob/master/doc/LercCodecSpec.md
+const (
+	lercVersion   = 4
+	lercBlockSize = 8
+	lercFloat32   = 6 // Lerc2 data type for float32 samples
+)
+
+// LercHeaderSize is the size of a Lerc2 version 4 header in bytes.
+const lercHeaderSize = 6 + 4 + 4 + 7*4 + 3*8
+
+// EncodeLerc compresses a tile of float32 samples into a Lerc2 blob.
+// For tiles with several bands, the samples of each pixel must be
+// interleaved. No decoded sample will differ from the original sample
+// by more than maxError; if maxError is zero, the compression is lossless.
+func encodeLerc(samples []float32, width, height, bands int, maxError float64) []byte {
+	le := binary.LittleEndian
+	mins := make([]float32, bands)
+	maxs := make([]float32, bands)
+	for b := range bands {
+		mins[b], maxs[b] = samples[b], samples[b]
+	}
+	for i, s := range samples {
+		b := i % bands
+		mins[b], maxs[b] = min(mins[b], s), max(maxs[b], s)
+	}
+	zMin, zMax := slices.Min(mins), slices.Max(maxs)
+
+	buf := make([]byte, 0, lercHeaderSize+len(samples))
+	buf = append(buf, "Lerc2 "...)
+	buf = le.AppendUint32(buf, lercVersion)
+	buf = le.AppendUint32(buf, 0) // checksum, filled in below
+	buf = le.AppendUint32(buf, uint32(height))
+	buf = le.AppendUint32(buf, uint32(width))
+	buf = le.AppendUint32(buf, uint32(bands))
+	buf = le.AppendUint32(buf, uint32(width*height)) // valid pixels
+	buf = le.AppendUint32(buf, lercBlockSize)
+	buf = le.AppendUint32(buf, 0) // blob size, filled in below
+	buf = le.AppendUint32(buf, lercFloat32)
+	buf = le.AppendUint64(buf, math.Float64bits(maxError))
+	buf = le.AppendUint64(buf, math.Float64bits(float64(zMin)))
+	buf = le.AppendUint64(buf, math.Float64bits(float64(zMax)))
+
+	// All pixels are valid, so the validity mask is empty.
+	buf = le.AppendUint32(buf, 0)
+
+	if zMin != zMax {
+		for _, m := range mins {
+			buf = le.AppendUint32(buf, math.Float32bits(m))
+		}
+		for _, m := range maxs {
+			buf = le.AppendUint32(buf, math.Float32bits(m))
+		}
+		constant := true
+		for b := range bands {
+			constant = constant && mins[b] == maxs[b]
+		}
+		if !constant {
+			buf = append(buf, 0) // encoded in blocks, not in one sweep
+			block := make([]float32, 0, lercBlockSize*lercBlockSize)
+			for y0 := 0; y0 < height; y0 += lercBlockSize {
+				y1 := min(y0+lercBlockSize, height)
+				for x0 := 0; x0 < width; x0 += lercBlockSize {
+					x1 := min(x0+lercBlockSize, width)
+					for b := range bands {
+						block = block[:0]
+						for y := y0; y < y1; y++ {
+							for x := x0; x < x1; x++ {
+								block = append(block, samples[(y*width+x)*bands+b])
+							}
+						}
+						buf = appendLercBlock(buf, block, x0, maxError, maxs[b])
+					}
+				}
+			}
+		}
+	}
+
+	le.PutUint32(buf[6+4+4+5*4:], uint32(len(buf)))
+	le.PutUint32(buf[6+4:], lercChecksum(buf[6+4+4:]))
+	return buf
+}
+
+// AppendLercBlock appends the encoding of one block of samples to buf.
+// Decoders clamp the dequantized samples to zMax. For detecting
+// corrupt data, bits 2 to 5 of the first byte hold the block’s left
+// column x0, divided by 8.
+func appendLercBlock(buf []byte, block []float32, x0 int, maxError float64, zMax float32) []byte {
+	const (
+		zeroBlock      = 2
+		constantBlock  = 3
+		quantizedBlock = 1
+		rawBlock       = 0
+	)
+	le := binary.LittleEndian
+	check := byte((x0>>3)&15) << 2
+	offset, top := slices.Min(block), slices.Max(block)
+
+	if offset == top {
+		if offset == 0 {
+			return append(buf, check|zeroBlock)
+		}
+		buf = append(buf, check|constantBlock)
+		return le.AppendUint32(buf, math.Float32bits(offset))
+	}
+
+	if quantized, ok := quantizeLerc(block, offset, maxError, zMax); ok {
+		maxQuant := slices.Max(quantized)
+		if maxQuant == 0 {
+			buf = append(buf, check|constantBlock)
+			return le.AppendUint32(buf, math.Float32bits(offset))
+		}
+		numBits := bits.Len32(maxQuant)
+		if size := (len(quantized)*numBits + 7) / 8; size < 4*len(block) {
+			buf = append(buf, check|quantizedBlock)
+			buf = le.AppendUint32(buf, math.Float32bits(offset))
+			return appendBitStuffed(buf, quantized, numBits)
+		}
+	}
+
+	buf = append(buf, check|rawBlock)
+	for _, s := range block {
+		buf = le.AppendUint32(buf, math.Float32bits(s))
+	}
+	return buf
+}
+
+// QuantizeLerc quantizes a block of samples, relative to their minimum
+// offset, into steps of 2*maxError. The result is not ok if some sample
+// would be decoded with a larger error than maxError, which can happen
+// for large values due to floating-point rounding.
+func quantizeLerc(block []float32, offset float32, maxError float64, zMax float32) ([]uint32, bool) {
+	if maxError <= 0 {
+		return nil, false
+	}
+	scale := 2 * maxError
+	quantized := make([]uint32, len(block))
+	for i, s := range block {
+		q := (float64(s)-float64(offset))/scale + 0.5
+		if q >= 1<<30 {
+			return nil, false
+		}
+		quantized[i] = uint32(q)
+
+		// Same as the decoder, to verify that the error is bounded.
+		decoded := float32(min(float64(offset)+float64(quantized[i])*scale, float64(zMax)))
+		if math.Abs(float64(decoded)-float64(s)) > maxError {
+			return nil, false
+		}
+	}
+	return quantized, true
+}
+
+// AppendBitStuffed appends values to buf, using numBits bits per value.
+// The values are preceded by a byte with numBits and the size of the
+// element count, and then the element count itself. The bits are packed
+// into little-endian 32-bit words, starting at the lowest bit; trailing
+// bytes of the last word that hold no bits get dropped.
+func appendBitStuffed(buf []byte, values []uint32, numBits int) []byte {
+	n := len(values)
+	switch {
+	case n < 1<<8:
+		buf = append(buf, byte(numBits)|2<<6, byte(n))
+	case n < 1<<16:
+		buf = append(buf, byte(numBits)|1<<6)
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(n))
+	default:
+		buf = append(buf, byte(numBits))
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(n))
+	}
+
+	words := make([]uint32, (n*numBits+31)/32)
+	pos := 0
+	for _, v := range values {
+		word, bit := pos/32, pos%32
+		words[word] |= v << bit
+		if bit+numBits > 32 {
+			words[word+1] |= v >> (32 - bit)
+		}
+		pos += numBits
+	}
+	start := len(buf)
+	for _, w := range words {
+		buf = binary.LittleEndian.AppendUint32(buf, w)
+	}
+	return buf[:start+(n*numBits+7)/8]
+}
+
+// LercChecksum computes the Fletcher-32 checksum of a Lerc2 blob,
+// starting right after the checksum field of the header.
+func lercChecksum(data []byte) uint32 {
+	sum1, sum2 := uint32(0xffff), uint32(0xffff)
+	for len(data) >= 2 {
+		// Reduce the sums often enough that they cannot overflow.
+		n := min(len(data)/2, 359)
+		for i := 0; i < n; i++ {
+			sum1 += uint32(data[2*i])<<8 | uint32(data[2*i+1])
+			sum2 += sum1
+		}
+		data = data[2*n:]
+		sum1 = sum1&0xffff + sum1>>16
+		sum2 = sum2&0xffff + sum2>>16
+	}
+	if len(data) == 1 {
+		sum1 += uint32(data[0]) << 8
+		sum2 += sum1
+	}
+	sum1 = sum1&0xffff + sum1>>16
+	sum2 = sum2&0xffff + sum2>>16
+	return sum2<<16 | sum1
+}
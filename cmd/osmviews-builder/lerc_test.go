@@ -0,0 +1,71 @@
+// SPDX-FileCopyrightText: 2026 Sascha Brawer <sascha@brawer.ch>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"encoding/hex"
+	"slices"
+	"testing"
+)
+
+// The expected blobs were produced by the reference implementation
+// of Esri’s LERC library, which we cannot call from Go.
+func TestEncodeLerc_Constant(t *testing.T) {
+	for _, tc := range []struct {
+		samples  []float32
+		bands    int
+		maxError float64
+		want     string
+	}{
+		{
+			slices.Repeat([]float32{1.5}, 16), 1, 0.25,
+			"4c657263322004000000c02d45e104000000040000000100000010000000080000004600000006000000000000000000d03f000000000000f83f000000000000f83f00000000",
+		},
+		{
+			// Each band is constant, but they differ.
+			slices.Repeat([]float32{1, 2}, 16), 2, 0.5,
+			"4c657263322004000000bf4f452304000000040000000200000010000000080000005600000006000000000000000000e03f000000000000f03f0000000000000040000000000000803f000000400000803f00000040",
+		},
+	} {
+		got := hex.EncodeToString(encodeLerc(tc.samples, 4, 4, tc.bands, tc.maxError))
+		if got != tc.want {
+			t.Errorf("got %s, want %s", got, tc.want)
+		}
+	}
+}
+
+func TestAppendBitStuffed(t *testing.T) {
+	values := make([]uint32, 8)
+	for i := range values {
+		values[i] = uint32(i % 5)
+	}
+	got := hex.EncodeToString(appendBitStuffed(nil, values, 3))
+	if want := "8308884644"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+// Blocks get stored as zero, constant, quantized or raw samples. If
+// quantization is not possible within the maximum error, the encoder
+// must store the block uncompressed. Bits 2 to 5 of the first byte hold
+// the left column of the block, divided by 8.
+func TestAppendLercBlock(t *testing.T) {
+	for _, tc := range []struct {
+		block    []float32
+		maxError float64
+		want     string
+	}{
+		{[]float32{0, 0, 0, 0}, 0.01, "06"},
+		{[]float32{3, 3, 3, 3}, 0.01, "0700004040"},
+		{[]float32{3, 3.001, 3, 3}, 0.01, "0700004040"},
+		{[]float32{0, 1, 2, 3}, 0.5, "05000000008204e4"},
+		{[]float32{0, 1e7}, 0.001, "04000000008096184b"},
+		{[]float32{0, 1}, 0, "04000000000000803f"},
+	} {
+		got := hex.EncodeToString(appendLercBlock(nil, tc.block, 8, tc.maxError, slices.Max(tc.block)))
+		if got != tc.want {
+			t.Errorf("%v: got %s, want %s", tc.block, got, tc.want)
+		}
+	}
+}
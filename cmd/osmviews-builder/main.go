@@ -9,27 +9,88 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 func main() {
 	ctx := context.Background()
 
 	workdir := flag.String("workdir", "osmviews-builder-workdir", "path to working directory")
+	storagedir := flag.String("storagedir", "", "path to local storage directory, used instead of S3")
+	tilelogs := flag.String("tilelogs", DefaultTileLogsURL, "comma-separated base URLs or local directories with daily tile log files, tried in order")
+	weeks := flag.Int("weeks", 52, "number of weeks to aggregate")
+	statisticName := flag.String("statistic", "median", "how to aggregate weekly counts: median, mean, max, pNN for a percentile, trimmedNN for a trimmed mean, or decayNN for exponential decay with a half-life of NN weeks")
+	trend := flag.Int("trend", 0, "if positive, additionally produce a trend file comparing the last N weeks against the same weeks one year earlier")
+	seasons := flag.String("seasons", "none", "additionally produce seasonal files for each complete quarter or month; one of none, quarter, month")
+	resamplingName := flag.String("resampling", "max", "how to compute overview pixels from 2x2 blocks: max, mean, area for the area-weighted mean, or sum for area plus a band of summed weekly views")
+	predictor := flag.Bool("predictor", false, "encode tiles with the TIFF floating-point predictor, which helps for densely viewed areas")
+	compressionName := flag.String("compression", "deflate", "how to compress tiles: deflate, zstd for faster decompression, or lerc for lossy compression")
+	maxError := flag.Float64("maxerror", 0.01, "for --compression=lerc, the largest allowed error of the stored ln(1 + weekly views per km2) values")
+	bigTIFF := flag.Bool("bigtiff", false, "write output files as BigTIFF, which can grow beyond 4 GiB")
+	zoom := flag.Int("zoom", 18, fmt.Sprintf("zoom level of the pixels in the main output, between %d and %d", minZoom, maxZoom))
+	companion := flag.Int("companion", 12, "zoom level of a small companion to the main output, or 0 for none")
+	maxChange := flag.Float64("maxchange", 0.25, "refuse to publish if the total views or the median changed by more than this fraction since the previous build")
+	maxShared := flag.Float64("maxshared", 0.05, "refuse to publish if the fraction of shared tiles changed by more than this since the previous build")
+	minCorrelation := flag.Float64("mincorrelation", 0.8, "refuse to publish if the rank correlation of probe locations with the previous build is lower than this")
+	skipCompare := flag.Bool("skipcompare", false, "publish without comparing the outputs against their previous builds, such as after an intentional change")
+	auxBands := flag.Bool("auxbands", false, "add bands for the weeks with views, the weekly views, and the deepest zoom level with views")
 	flag.Parse()
 
 	logger := log.Default()
 	logger.SetFlags(log.Ldate | log.Ltime | log.LUTC | log.Lshortfile)
 
+	if *weeks < 1 || *weeks > maxTileLogWeeks {
+		logger.Fatalf("--weeks must be between 1 and %d", maxTileLogWeeks)
+	}
+	statistic, err := ParseStatistic(*statisticName)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	resampling, err := ParseResampling(*resamplingName)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	compression, err := ParseCompression(*compressionName)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if compression == Lerc && *predictor {
+		logger.Fatalf("--predictor cannot be combined with --compression=lerc")
+	}
+	if *maxError < 0 {
+		logger.Fatalf("--maxerror must not be negative")
+	}
+	if *zoom < minZoom || *zoom > maxZoom {
+		logger.Fatalf("--zoom must be between %d and %d", minZoom, maxZoom)
+	}
+	if *companion != 0 && (*companion < minZoom || *companion > maxZoom) {
+		logger.Fatalf("--companion must be 0, or between %d and %d", minZoom, maxZoom)
+	}
+	if *trend < 0 || *trend+52 > maxTileLogWeeks {
+		logger.Fatalf("--trend must be between 0 and %d", maxTileLogWeeks-52)
+	}
+	if *seasons != "quarter" && *seasons != "month" && *seasons != "none" {
+		logger.Fatalf("--seasons must be none, quarter or month")
+	}
+	source, err := NewTileLogSource(*tilelogs, NewHTTPClient())
+	if err != nil {
+		logger.Fatal(err)
+	}
+
 	if *workdir != "" {
 		if err := os.MkdirAll(*workdir, 0755); err != nil {
 			logger.Fatal(err)
 		}
 	}
 
-	storage, err := NewStorage()
+	var storage Storage
+	if *storagedir != "" {
+		storage, err = NewLocalStorage(*storagedir)
+	} else {
+		storage, err = NewStorage()
+	}
 	if err != nil {
 		logger.Fatal(err)
 	}
@@ -41,88 +102,303 @@ func main() {
 		logger.Fatal("storage bucket \"osmviews\" does not exist")
 	}
 
-	maxWeeks := 52 // 1 year
-	tilecounts, lastWeek, err := fetchWeeklyLogs(*workdir, storage, maxWeeks)
+	// For seasonal files, we look at all the weeks whose tile logs
+	// we keep in storage, so we can find the most recent complete
+	// quarters or months.
+	fetchWeeks := *weeks
+	if *seasons != "none" || *trend > 0 {
+		fetchWeeks = maxTileLogWeeks
+	}
+	tilecounts, tilecountWeeks, err := fetchWeeklyLogs(*workdir, source, storage, fetchWeeks)
 	if err != nil {
 		logger.Fatal(err)
 	}
 
-	// Construct a file path for the output file. As part of the file name,
-	// we use the date of the last day of the last week whose data is being
-	// painted. That needs less explanation to users than some file name
-	// convention involving ISO weeks, which are less commonly known.
-	year, week, err := ParseWeek(lastWeek)
+	opts := buildOptions{
+		Workdir:       *workdir,
+		Weeks:         *weeks,
+		StatisticName: *statisticName,
+		Statistic:     statistic,
+		Resampling:    resampling,
+		Zoom:          *zoom,
+		Companion:     *companion,
+		Trend:         *trend,
+		Seasons:       *seasons,
+		AuxBands:      *auxBands,
+		Predictor:     *predictor,
+		Compression:   compression,
+		MaxError:      *maxError,
+		BigTIFF:       *bigTIFF,
+	}
+	outputs, products, err := planOutputs(opts, tilecountWeeks)
 	if err != nil {
 		logger.Fatal(err)
 	}
-	lastDay := weekStart(year, week).AddDate(0, 0, 6)
-	date := lastDay.Format("20060102")
-	bucket := "osmviews"
-	localpath := filepath.Join(*workdir, fmt.Sprintf("osmviews-%s.tiff", date))
-	localStatsPath := filepath.Join(*workdir, fmt.Sprintf("osmviews-stats-%s.json", date))
-	localStatsPlotPath := filepath.Join(*workdir, fmt.Sprintf("osmviews-statsplot-%s.png", date))
-	remotepath := fmt.Sprintf("public/osmviews-%s.tiff", date)
-	remoteStatsPath := fmt.Sprintf("public/osmviews-stats-%s.json", date)
 
-	// Check if the output file already exists in storage.
+	// Check which output files already exist in storage.
 	// If we can retrieve object stats without an error, we don’t need
-	// to do anything and are completely done.
-	if storage != nil {
-		_, err := storage.Stat(ctx, bucket, remotepath)
+	// to paint them again. If all exist, we are completely done.
+	bucket := "osmviews"
+	jobs := make([]PaintJob, 0, len(outputs))
+	pending := make([]*output, 0, len(outputs))
+	for _, out := range outputs {
+		_, err := storage.Stat(ctx, bucket, out.remotePath)
 		hasGeoTiff := err == nil
-		_, err = storage.Stat(ctx, bucket, remoteStatsPath)
-		hasStats := err == nil
+		hasStats := true
+		if out.remoteStatsPath != "" {
+			_, err = storage.Stat(ctx, bucket, out.remoteStatsPath)
+			hasStats = err == nil
+		}
 		if hasGeoTiff && hasStats {
-			msg := fmt.Sprintf("Already in storage: %s/%s and %s/%s", bucket, remotepath, bucket, remoteStatsPath)
+			msg := fmt.Sprintf("Already in storage: %s/%s", bucket, out.remotePath)
 			logger.Println(msg)
-			return
+			continue
 		}
+		jobs = append(jobs, out.job)
+		pending = append(pending, out)
+	}
+	if len(pending) == 0 {
+		return
 	}
 
-	// Paint the output GeoTIFF file.
-	if err := paint(localpath, 18, tilecounts, ctx); err != nil {
+	// Paint the output GeoTIFF files, all in one pass over the tile logs.
+	if err := paintJobs(jobs, uint8(*zoom), tilecounts, tilecountWeeks, ctx); err != nil {
 		logger.Fatal(err)
 	}
 
-	if err := BuildStats(localpath, localStatsPath, localStatsPlotPath); err != nil {
-		logger.Fatal(err)
+	// Before publishing anything, make sure that all painted files
+	// are valid. If the writer had a bug, we would rather fail loudly
+	// than ship a corrupt file to all our users.
+	// Trend files have no statistics because their pixels are signed
+	// log ratios, not view densities.
+	for _, out := range pending {
+		if err := ValidateCOG(out.job.Path); err != nil {
+			logger.Fatal(err)
+		}
+		if out.remoteStatsPath != "" {
+			if err := BuildStats(out.job.Path, out.localStatsPath, out.localStatsPlotPath); err != nil {
+				logger.Fatal(err)
+			}
+		}
 	}
 
-	// Upload the output file to storage, and garbage-collect old files.
-	if storage != nil {
-		err := storage.PutFile(ctx, bucket, remotepath, localpath, "image/tiff")
-		if err != nil {
+	// Likewise, bad upstream data such as truncated tile logs would
+	// make the rankings of our users jump. To catch this, we compare
+	// each output against its previous version.
+	if !*skipCompare {
+		limits := comparisonLimits{
+			MaxChange:      *maxChange,
+			MaxSharedDelta: *maxShared,
+			MinCorrelation: *minCorrelation,
+		}
+		if err := compareOutputs(ctx, storage, bucket, *workdir, pending, limits); err != nil {
 			logger.Fatal(err)
 		}
+	}
 
-		err = storage.PutFile(ctx, bucket, remoteStatsPath, localStatsPath, "application/json")
+	for _, out := range pending {
+		// Upload the output files to storage.
+		err := storage.PutFile(ctx, bucket, out.remotePath, out.job.Path, "image/tiff")
 		if err != nil {
 			logger.Fatal(err)
 		}
+		logger.Printf("Uploaded to storage: %s/%s", bucket, out.remotePath)
+
+		if out.remoteStatsPath != "" {
+			err = storage.PutFile(ctx, bucket, out.remoteStatsPath, out.localStatsPath, "application/json")
+			if err != nil {
+				logger.Fatal(err)
+			}
+			logger.Printf("Uploaded to storage: %s/%s", bucket, out.remoteStatsPath)
+		}
+	}
+
+	// Garbage-collect old files.
+	if err := Cleanup(storage, products, zoomSuffix(*zoom)); err != nil {
+		logger.Fatal(err)
+	}
+}
 
-		msg := fmt.Sprintf("Uploaded to storage: %s/%s and %s/%s\n", bucket, remotepath, bucket, remoteStatsPath)
-		logger.Println(msg)
+// Output is a product that gets painted by the builder, together with
+// the paths of its files on local disk and in storage. If the product
+// has no statistics file, its stats paths are empty.
+type output struct {
+	product            string
+	job                PaintJob
+	localStatsPath     string
+	localStatsPlotPath string
+	remotePath         string
+	remoteStatsPath    string
+}
 
-		if err := Cleanup(storage); err != nil {
-			logger.Fatal(err)
+func newOutput(workdir, product string, weeks []string, firstWeek, limitWeek int, statistic Statistic) (*output, error) {
+	// Construct file paths for the output files. As part of the file name,
+	// we use the date of the last day of the last week whose data is being
+	// painted. That needs less explanation to users than some file name
+	// convention involving ISO weeks, which are less commonly known.
+	year, week, err := ParseWeek(weeks[limitWeek-1])
+	if err != nil {
+		return nil, err
+	}
+	lastDay := weekStart(year, week).AddDate(0, 0, 6)
+	date := lastDay.Format("20060102")
+	return &output{
+		product: product,
+		job: PaintJob{
+			Path:      filepath.Join(workdir, fmt.Sprintf("%s-%s.tiff", product, date)),
+			FirstWeek: firstWeek,
+			LimitWeek: limitWeek,
+			Statistic: statistic,
+		},
+		localStatsPath:     filepath.Join(workdir, fmt.Sprintf("%s-stats-%s.json", product, date)),
+		localStatsPlotPath: filepath.Join(workdir, fmt.Sprintf("%s-statsplot-%s.png", product, date)),
+		remotePath:         fmt.Sprintf("public/%s-%s.tiff", product, date),
+		remoteStatsPath:    fmt.Sprintf("public/%s-stats-%s.json", product, date),
+	}, nil
+}
+
+// BuildOptions are the command-line settings that determine
+// which outputs the builder produces.
+type buildOptions struct {
+	Workdir       string
+	Weeks         int
+	StatisticName string
+	Statistic     Statistic
+	Resampling    Resampling
+	Zoom          int
+	Companion     int // 0 for none
+	Trend         int // 0 for none
+	Seasons       string
+	AuxBands      bool
+	Predictor     bool
+	Compression   Compression
+	MaxError      float64
+	BigTIFF       bool
+}
+
+// PlanOutputs returns the outputs to produce from the tile logs for
+// a list of weeks, and the products whose old versions get cleaned up
+// from storage. The main output and its product always come first.
+func planOutputs(opts buildOptions, tilecountWeeks []string) ([]*output, []string, error) {
+	// The default product is called "osmviews". Other aggregations
+	// get a product name like "osmviews-13w-mean", so they can live
+	// side by side in storage. Since the resampling changes the
+	// overviews, it becomes part of the name as well, such as
+	// "osmviews-52w-median-area"; likewise for the resolution,
+	// such as "osmviews-z14".
+	baseProduct := "osmviews"
+	if opts.Weeks != 52 || opts.StatisticName != "median" || opts.Resampling != ResampleMax {
+		baseProduct = fmt.Sprintf("osmviews-%dw-%s", opts.Weeks, opts.StatisticName)
+	}
+	if opts.Resampling != ResampleMax {
+		baseProduct += "-" + opts.Resampling.String()
+	}
+	product := baseProduct + zoomSuffix(opts.Zoom)
+
+	logger := log.Default()
+	outputs := make([]*output, 0, 6)
+	firstWeek := max(len(tilecountWeeks)-opts.Weeks, 0)
+	primary, err := newOutput(opts.Workdir, product, tilecountWeeks, firstWeek, len(tilecountWeeks), opts.Statistic)
+	if err != nil {
+		return nil, nil, err
+	}
+	primary.job.AuxBands = opts.AuxBands
+	primary.job.Resampling = opts.Resampling
+	primary.job.Zoom = uint8(opts.Zoom)
+	outputs = append(outputs, primary)
+	products := []string{product}
+	if opts.Companion != 0 && opts.Companion < opts.Zoom {
+		// The companion is the same as the main output at a coarser
+		// resolution, such as "osmviews-z12". Many users only need
+		// city-level ranks, for which a much smaller file is
+		// more convenient than the full-resolution one.
+		name := fmt.Sprintf("%s-z%d", baseProduct, opts.Companion)
+		out, err := newOutput(opts.Workdir, name, tilecountWeeks, firstWeek, len(tilecountWeeks), opts.Statistic)
+		if err != nil {
+			return nil, nil, err
+		}
+		path := out.job.Path
+		out.job = primary.job
+		out.job.Path = path
+		out.job.Zoom = uint8(opts.Companion)
+		outputs = append(outputs, out)
+		products = append(products, name)
+	}
+	if opts.Trend > 0 {
+		// The baseline is the same weeks one year earlier. Since the
+		// trend compares weeks of the same season, seasonal effects
+		// such as winter tourism do not show up as trends.
+		limit := len(tilecountWeeks)
+		if limit-opts.Trend-52 >= 0 {
+			name := fmt.Sprintf("osmviews-trend-%dw%s", opts.Trend, zoomSuffix(opts.Zoom))
+			out, err := newOutput(opts.Workdir, name, tilecountWeeks, limit-opts.Trend, limit, Median)
+			if err != nil {
+				return nil, nil, err
+			}
+			out.job.BaselineFirstWeek = limit - opts.Trend - 52
+			out.job.BaselineLimitWeek = limit - 52
+			out.localStatsPath, out.localStatsPlotPath, out.remoteStatsPath = "", "", ""
+			outputs = append(outputs, out)
+			products = append(products, name)
+		} else {
+			logger.Printf("not enough weeks of tile logs for a %d-week trend", opts.Trend)
+		}
+	}
+	if opts.Seasons != "none" {
+		found, err := FindSeasons(tilecountWeeks, opts.Seasons)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, season := range found {
+			name := fmt.Sprintf("osmviews-%s%s", season.Name, zoomSuffix(opts.Zoom))
+			out, err := newOutput(opts.Workdir, name, tilecountWeeks, season.FirstWeek, season.LimitWeek, Median)
+			if err != nil {
+				return nil, nil, err
+			}
+			outputs = append(outputs, out)
+		}
+	}
+
+	// Except for the companion, all outputs are at the zoom level
+	// of the main output.
+	for _, out := range outputs {
+		if out.job.Zoom == 0 {
+			out.job.Zoom = uint8(opts.Zoom)
 		}
+		out.job.Predictor = opts.Predictor
+		out.job.Compression = opts.Compression
+		out.job.MaxError = opts.MaxError
+		out.job.BigTIFF = opts.BigTIFF
 	}
+	return outputs, products, nil
 }
 
-// Fetch log data for up to `maxWeeks` weeks from planet.openstreetmap.org.
-// For each week, the seven daily log files are fetched from OpenStreetMap,
-// and combined into a one single compressed file, stored on local disk.
+// ZoomSuffix returns the suffix for the names of products whose
+// pixels are at a zoom level, such as "-z14". At the default zoom 18,
+// the suffix is empty.
+func zoomSuffix(zoom int) string {
+	if zoom == 18 {
+		return ""
+	}
+	return fmt.Sprintf("-z%d", zoom)
+}
+
+// Fetch log data for up to `maxWeeks` weeks from the tile log source,
+// by default planet.openstreetmap.org. For each week, the seven daily
+// log files are fetched, and combined into a one single compressed file, stored on local disk.
 // If this weekly file already exists on disk, we return its content directly
 // without re-fetching that week from the server. Therefore, if this tool
 // is run periodically, it will only fetch the content that has not been
 // downloaded before. The result is an array of readers (one for each week),
-// and the ISO week string (like "2021-W28") for the last available week.
-func fetchWeeklyLogs(workdir string, storage Storage, maxWeeks int) ([]io.Reader, string, error) {
+// and the ISO week strings (like "2021-W28") for the readers, oldest first.
+func fetchWeeklyLogs(workdir string, source *TileLogSource, storage Storage, maxWeeks int) ([]io.Reader, []string, error) {
 	logger := log.Default()
-	client := &http.Client{}
-	weeks, err := GetAvailableWeeks(client)
+	weeks, err := GetAvailableWeeks(source)
 	if err != nil {
-		return nil, "", err
+		return nil, nil, err
+	}
+	if len(weeks) == 0 {
+		return nil, nil, fmt.Errorf("no complete weeks of tile logs at %s", strings.Join(source.Locations, ", "))
 	}
 
 	if len(weeks) > maxWeeks {
@@ -135,12 +411,12 @@ func fetchWeeklyLogs(workdir string, storage Storage, maxWeeks int) ([]io.Reader
 
 	readers := make([]io.Reader, 0, len(weeks))
 	for _, week := range weeks {
-		if r, err := GetTileLogs(week, client, workdir, storage); err == nil {
+		if r, err := GetTileLogs(week, source, workdir, storage); err == nil {
 			readers = append(readers, r)
 		} else {
-			return nil, "", err
+			return nil, nil, err
 		}
 	}
 
-	return readers, weeks[len(weeks)-1], nil
+	return readers, weeks, nil
 }
@@ -0,0 +1,174 @@
+// SPDX-FileCopyrightText: 2026 Sascha Brawer <sascha@brawer.ch>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestWeeks returns n consecutive ISO weeks, ending with 2022-W01.
+func testWeeks(n int) []string {
+	last := weekStart(2022, 1)
+	weeks := make([]string, n)
+	for i := range weeks {
+		year, week := last.AddDate(0, 0, -7*(n-1-i)).ISOWeek()
+		weeks[i] = fmt.Sprintf("%04d-W%02d", year, week)
+	}
+	return weeks
+}
+
+func testBuildOptions() buildOptions {
+	return buildOptions{
+		Workdir:       "workdir",
+		Weeks:         52,
+		StatisticName: "median",
+		Statistic:     Median,
+		Resampling:    ResampleMax,
+		Zoom:          18,
+		Companion:     12,
+		Seasons:       "none",
+	}
+}
+
+func TestPlanOutputs(t *testing.T) {
+	opts := testBuildOptions()
+	opts.AuxBands = true
+	opts.Compression = Zstd
+	opts.BigTIFF = true
+	outputs, products, err := planOutputs(opts, testWeeks(60))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(products, " "); got != "osmviews osmviews-z12" {
+		t.Errorf("got products %q, want %q", got, "osmviews osmviews-z12")
+	}
+	if len(outputs) != 2 {
+		t.Fatalf("got %d outputs, want 2", len(outputs))
+	}
+
+	primary, companion := outputs[0], outputs[1]
+	if got, want := primary.remotePath, "public/osmviews-20220109.tiff"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := companion.remotePath, "public/osmviews-z12-20220109.tiff"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := companion.remoteStatsPath, "public/osmviews-z12-stats-20220109.json"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := companion.job.Path, filepath.Join("workdir", "osmviews-z12-20220109.tiff"); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Except for its path and zoom, the companion's job is the same
+	// as the one of the main output. Functions cannot be compared,
+	// so we leave out the statistic.
+	got, want := companion.job, primary.job
+	want.Path, want.Zoom = got.Path, 12
+	got.Statistic, want.Statistic = nil, nil
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got companion job %+v, want %+v", got, want)
+	}
+	if !want.AuxBands || want.FirstWeek != 8 || want.LimitWeek != 60 || want.Compression != Zstd || !want.BigTIFF {
+		t.Errorf("got main job %+v", primary.job)
+	}
+}
+
+func TestPlanOutputs_Names(t *testing.T) {
+	for _, tc := range []struct {
+		resampling      Resampling
+		zoom, companion int
+		want            string
+	}{
+		{ResampleMax, 18, 12, "osmviews osmviews-z12"},
+		{ResampleMax, 18, 0, "osmviews"},
+		{ResampleMax, 14, 12, "osmviews-z14 osmviews-z12"},
+		{ResampleMax, 12, 12, "osmviews-z12"},
+		{ResampleMax, 10, 12, "osmviews-z10"},
+		{ResampleArea, 18, 12, "osmviews-52w-median-area osmviews-52w-median-area-z12"},
+		{ResampleSum, 18, 12, "osmviews-52w-median-sum osmviews-52w-median-sum-z12"},
+	} {
+		opts := testBuildOptions()
+		opts.Resampling, opts.Zoom, opts.Companion = tc.resampling, tc.zoom, tc.companion
+		outputs, products, err := planOutputs(opts, testWeeks(52))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(products, " "); got != tc.want {
+			t.Errorf("%s, zoom %d, companion %d: got %q, want %q", tc.resampling, tc.zoom, tc.companion, got, tc.want)
+		}
+		for _, out := range outputs {
+			if out.job.Resampling != tc.resampling {
+				t.Errorf("%s: got resampling %s, want %s", out.remotePath, out.job.Resampling, tc.resampling)
+			}
+		}
+	}
+}
+
+func TestPlanOutputs_TrendAndSeasons(t *testing.T) {
+	opts := testBuildOptions()
+	opts.Trend = 13
+	opts.Seasons = "quarter"
+	outputs, products, err := planOutputs(opts, testWeeks(65))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(products, " "), "osmviews osmviews-z12 osmviews-trend-13w"; got != want {
+		t.Errorf("got products %q, want %q", got, want)
+	}
+
+	var trend *output
+	for _, out := range outputs {
+		if strings.Contains(out.remotePath, "trend") {
+			trend = out
+		}
+	}
+	if trend == nil {
+		t.Fatal("no trend output")
+	}
+	if trend.remoteStatsPath != "" || trend.job.BaselineFirstWeek != 0 || trend.job.BaselineLimitWeek != 13 {
+		t.Errorf("got trend output %+v", trend)
+	}
+
+	// Seasonal outputs are not in products, since Cleanup
+	// has its own patterns for them.
+	if len(outputs) <= 3 {
+		t.Errorf("got %d outputs, want seasonal outputs too", len(outputs))
+	}
+}
+
+// Seasonal and trend outputs are at the same zoom level as the main
+// output, and their names tell the zoom level unless it is the default.
+func TestPlanOutputs_Zoom(t *testing.T) {
+	for _, zoom := range []int{18, 14} {
+		opts := testBuildOptions()
+		opts.Zoom = zoom
+		opts.Trend = 13
+		opts.Seasons = "quarter"
+		outputs, _, err := planOutputs(opts, testWeeks(65))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(outputs) <= 3 {
+			t.Fatalf("zoom %d: got %d outputs, want seasonal outputs too", zoom, len(outputs))
+		}
+		for i, out := range outputs {
+			want := uint8(zoom)
+			if i == 1 {
+				want = 12 // companion
+			}
+			if out.job.Zoom != want {
+				t.Errorf("%s: got zoom %d, want %d", out.remotePath, out.job.Zoom, want)
+			}
+			if hasSuffix := strings.Contains(out.remotePath, "-z14-"); hasSuffix != (zoom == 14 && i != 1) {
+				t.Errorf("zoom %d: got %s", zoom, out.remotePath)
+			}
+		}
+	}
+}
@@ -10,7 +10,18 @@ import (
 	"io"
 )
 
-func mergeTileCounts(r []io.Reader, out chan<- TileCount, ctx context.Context) error {
+// WeeklyTileCount is a TileCount that was read by mergeTileCounts
+// from one of its inputs. Week is the index of that input; since we
+// pass the weekly tile logs in chronological order, this tells which
+// week the count came from.
+type WeeklyTileCount struct {
+	TileCount
+	Week int
+}
+
+// MergeTileCounts merges sorted streams of tile counts, one for each week,
+// into a single sorted stream that gets sent to channel `out`.
+func mergeTileCounts(r []io.Reader, out chan<- WeeklyTileCount, ctx context.Context) error {
 	defer close(out)
 	if len(r) == 0 {
 		return nil
@@ -26,7 +37,7 @@ func mergeTileCounts(r []io.Reader, out chan<- TileCount, ctx context.Context) e
 		default:
 		}
 
-		out <- merger.TileCount()
+		out <- WeeklyTileCount{merger.TileCount(), merger.Week()}
 	}
 
 	if err := merger.Err(); err != nil {
@@ -45,8 +56,8 @@ type TileCountMerger struct {
 func NewTileCountMerger(r []io.Reader) *TileCountMerger {
 	m := &TileCountMerger{}
 	m.heap = make(tileCountHeap, 0, len(r))
-	for _, rr := range r {
-		stream := &tileCountStream{scanner: bufio.NewScanner(rr)}
+	for i, rr := range r {
+		stream := &tileCountStream{scanner: bufio.NewScanner(rr), week: i}
 		if stream.scanner.Scan() {
 			stream.tc = ParseTileCount(stream.scanner.Text())
 			m.heap = append(m.heap, stream)
@@ -98,10 +109,21 @@ func (m *TileCountMerger) TileCount() TileCount {
 	}
 }
 
+// Week returns the index of the input stream from which the current
+// TileCount was read, or -1 if there is no current TileCount.
+func (m *TileCountMerger) Week() int {
+	if len(m.heap) > 0 {
+		return m.heap[0].week
+	} else {
+		return -1
+	}
+}
+
 type tileCountStream struct {
 	tc      TileCount
 	scanner *bufio.Scanner
-	index   int
+	index   int // position in heap
+	week    int // position in input array
 }
 
 type tileCountHeap []*tileCountStream
@@ -55,17 +55,20 @@ func TestMergeTileCounts(t *testing.T) {
 	}
 
 	for i := 0; i < len(got); i++ {
-		if got[i] != want[i] {
-			t.Fatalf("got TileCount[%d]=%v, want %v", i, got[i], want[i])
+		if got[i].TileCount != want[i] {
+			t.Fatalf("got TileCount[%d]=%v, want %v", i, got[i].TileCount, want[i])
+		}
+		if got[i].Week != int(want[i].Count) {
+			t.Fatalf("got TileCount[%d].Week=%d, want %d", i, got[i].Week, want[i].Count)
 		}
 	}
 }
 
 // Helper for testing mergeTileCounts().
-func readMerged(readers []io.Reader) ([]TileCount, error) {
-	result := make([]TileCount, 0, 10000)
+func readMerged(readers []io.Reader) ([]WeeklyTileCount, error) {
+	result := make([]WeeklyTileCount, 0, 10000)
 	// To test channel overflow, pass a channel that buffers just one item.
-	ch := make(chan TileCount, 1)
+	ch := make(chan WeeklyTileCount, 1)
 	g, ctx := errgroup.WithContext(context.Background())
 	g.Go(func() error {
 		return mergeTileCounts(readers, ch, ctx)
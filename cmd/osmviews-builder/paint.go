@@ -8,33 +8,45 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"slices"
 
 	"golang.org/x/sync/errgroup"
 )
 
 type Painter struct {
-	numWeeks int
-	zoom     uint8
-	last     TileKey
-	raster   *Raster
-	writer   *RasterWriter
+	statistic  Statistic
+	resampling Resampling
+	zoom       uint8
+	last       TileKey
+	raster     *Raster
+	writer     rasterSink
+	auxWriter  *RasterWriter // non-nil if the output has auxiliary bands
 }
 
-func (p *Painter) Paint(tile TileKey, counts []uint64) error {
+// RasterSink receives the rasters that have been painted by a Painter.
+// The usual implementation is RasterWriter; for trend outputs, a pair of
+// painters sends its rasters to a trendWriter.
+type rasterSink interface {
+	Write(r *Raster) error
+	WriteUniformDensity(tile TileKey, viewsPerKm2 float32) error
+	Close() error
+	abort()
+}
+
+// Paint paints the view counts for a tile. The counts of the weeks
+// in which the tile was viewed are in ascending order; the series
+// has the counts of all weeks in chronological order.
+func (p *Painter) Paint(tile TileKey, counts []uint64, series *TileSeries) error {
 	raster, err := p.setupRaster(tile)
 	if err != nil {
 		return err
 	}
 
-	// Compute the median weekly views per km² for this tile.
-	numWeeksWithoutData := p.numWeeks - len(counts)
-	medianPos := p.numWeeks/2 - numWeeksWithoutData
-	var median float32
-	if medianPos >= 0 {
-		median = float32(counts[medianPos])
-	}
+	// Compute the weekly views per km² for this tile, by default
+	// the median over all weeks.
+	views := p.statistic(counts, series)
 	zoom, _, y := tile.ZoomXY()
-	viewsPerKm2 := median / float32(TileArea(zoom, y))
+	viewsPerKm2 := views / float32(TileArea(zoom, y))
 
 	if tile == raster.tile {
 		raster.viewsPerKm2 = viewsPerKm2
@@ -44,6 +56,9 @@ func (p *Painter) Paint(tile TileKey, counts []uint64) error {
 	}
 
 	raster.Paint(tile, viewsPerKm2)
+	if raster.aux != nil {
+		raster.PaintAux(tile, views, float32(len(counts)))
+	}
 
 	p.last = tile
 	return nil
@@ -71,7 +86,7 @@ func (p *Painter) setupRaster(tile TileKey) (*Raster, error) {
 	}
 
 	if p.raster == nil {
-		p.raster = NewRaster(WorldTile, nil)
+		p.raster = p.newRaster(WorldTile, nil)
 		if rasterTile == WorldTile {
 			return p.raster, nil
 		}
@@ -79,20 +94,42 @@ func (p *Painter) setupRaster(tile TileKey) (*Raster, error) {
 
 	for t := p.last.Next(p.zoom - 8); t < rasterTile; t = t.Next(p.zoom - 8) {
 		if t.Contains(rasterTile) {
-			p.raster = NewRaster(t, p.raster)
+			p.raster = p.newRaster(t, p.raster)
 		} else {
-			err := p.writer.WriteUniform(t, uint32(p.raster.viewsPerKm2+0.5))
-			if err != nil {
+			if err := p.writeUniform(t); err != nil {
 				return nil, err
 			}
 		}
 	}
 
-	p.raster = NewRaster(rasterTile, p.raster)
+	p.raster = p.newRaster(rasterTile, p.raster)
 	//fmt.Printf("final rasterTile=%s tile=%s\n", rasterTile, tile)
 	return p.raster, nil
 }
 
+func (p *Painter) newRaster(tile TileKey, parent *Raster) *Raster {
+	r := NewRaster(tile, parent)
+	if p.auxWriter != nil {
+		r.initAux()
+	}
+	return r
+}
+
+// WriteUniform emits a uniform raster for a tile that is covered
+// by the current raster, but for which no views have been painted.
+func (p *Painter) writeUniform(tile TileKey) error {
+	if p.auxWriter == nil {
+		return p.writer.WriteUniformDensity(tile, p.raster.viewsPerKm2)
+	}
+	color := uint32(p.raster.viewsPerKm2 + 0.5)
+
+	// The views of the raster are spread over the pixels of its
+	// descendants, which are smaller by a factor of 4 per zoom level.
+	aux := p.raster.aux.uniform
+	aux.views /= float32(uint64(1) << (2 * (tile.Zoom() - p.raster.tile.Zoom())))
+	return p.auxWriter.WriteUniformAux(tile, color, aux)
+}
+
 func (p *Painter) Close() error {
 	// For the part of the world we haven't covered yet, emit uniform rasters.
 	zoom := p.zoom - 8
@@ -102,7 +139,7 @@ func (p *Painter) Close() error {
 				return err
 			}
 		}
-		if err := p.writer.WriteUniform(t, uint32(p.raster.viewsPerKm2+0.5)); err != nil {
+		if err := p.writeUniform(t); err != nil {
 			return err
 		}
 	}
@@ -116,53 +153,253 @@ func (p *Painter) Close() error {
 	return p.writer.Close()
 }
 
+// Abort gives up painting after an error, without producing any output.
+func (p *Painter) abort() {
+	p.writer.abort()
+}
+
 // Function emitRaster is called when the Painter has finished painting
 // pixels into the current Raster. The raster gets removed from the tree,
 // compressed, and stored into a temporary file.
-// TODO: Subsample pixels to parent raster on behalf of GeoTIFF overview.
 func (p *Painter) emitRaster() error {
 	raster := p.raster
 	if raster.parent != nil {
-		raster.parent.PaintChild(raster)
+		raster.parent.PaintChild(raster, p.resampling)
 	}
 	p.raster = raster.parent
 	raster.parent = nil
 	return p.writer.Write(raster)
 }
 
-func NewPainter(path string, numWeeks int, zoom uint8) (*Painter, error) {
+func NewPainter(path string, statistic Statistic, zoom uint8) (*Painter, error) {
 	writer, err := NewRasterWriter(path, zoom-8)
 	if err != nil {
 		return nil, err
 	}
+	return newPainterForSink(writer, statistic, zoom), nil
+}
+
+// NewAuxPainter returns a Painter whose output has auxiliary bands
+// with the number of weeks with views, the weekly views, and the
+// deepest zoom level with views for each pixel.
+func NewAuxPainter(path string, statistic Statistic, zoom uint8) (*Painter, error) {
+	writer, err := NewAuxRasterWriter(path, zoom-8)
+	if err != nil {
+		return nil, err
+	}
+	p := newPainterForSink(writer, statistic, zoom)
+	p.auxWriter = writer
+	return p, nil
+}
+
+func newPainterForSink(sink rasterSink, statistic Statistic, zoom uint8) *Painter {
 	return &Painter{
-		numWeeks: numWeeks,
-		zoom:     zoom,
-		writer:   writer,
-	}, nil
+		statistic: statistic,
+		zoom:      zoom,
+		writer:    sink,
+	}
+}
+
+// PaintJob describes a GeoTIFF file to be painted from the weekly
+// tile logs in the range [FirstWeek, LimitWeek). Several jobs can be
+// painted in a single pass over the tile logs.
+//
+// If the baseline range is not empty, the job produces a trend output
+// whose pixels compare [FirstWeek, LimitWeek) against the baseline
+// range [BaselineFirstWeek, BaselineLimitWeek); see trendWriter.
+//
+// If AuxBands is set, the output has auxiliary bands; see NewAuxPainter.
+// Trend outputs do not support auxiliary bands. Resampling tells how
+// the overview images get computed; the zero value is ResampleMax.
+// ResampleSum implies auxiliary bands, whose weekly views it sums up.
+// If Predictor is set, the tiles get encoded with the TIFF floating-point
+// predictor, which makes dense tiles compress better. Compression is
+// the scheme for compressing tiles; the zero value means Deflate.
+// For LERC compression, MaxError is the largest allowed error of the
+// stored samples, which are the logarithmized view densities.
+// If BigTIFF is set, the output is written in the BigTIFF format,
+// which can grow beyond 4 GiB. Zoom is the zoom level of the output
+// pixels, between minZoom and maxZoom; the zero value means the zoom
+// level passed to paintJobs.
+type PaintJob struct {
+	Path              string
+	FirstWeek         int
+	LimitWeek         int
+	BaselineFirstWeek int
+	BaselineLimitWeek int
+	Statistic         Statistic
+	AuxBands          bool
+	Resampling        Resampling
+	Predictor         bool
+	Compression       Compression
+	MaxError          float64
+	BigTIFF           bool
+	Zoom              uint8
+}
+
+// ConfigureWriter applies the encoding options of a job to a writer.
+func (job *PaintJob) configureWriter(w *RasterWriter) {
+	w.predictor = job.Predictor
+	w.bigTIFF = job.BigTIFF
+	if job.Compression != 0 {
+		w.compression = job.Compression
+	}
+	w.maxError = job.MaxError
+}
+
+func (job *PaintJob) isTrend() bool {
+	return job.BaselineLimitWeek > job.BaselineFirstWeek
+}
+
+// WindowPainter is a Painter for the weeks in [first, limit).
+type windowPainter struct {
+	painter      *Painter
+	first, limit int
 }
 
 // Paint produces a GeoTIFF file from a set of weekly tile view counts.
-// Tile views at zoom level `zoom` become one pixel in the output GeoTIFF.
-func paint(path string, zoom uint8, tilecounts []io.Reader, ctx context.Context) error {
+// Tile views at zoom level `zoom` become one pixel in the output GeoTIFF,
+// whose value is computed from the weekly counts by `statistic`.
+// For each reader in `tilecounts`, `weeks` has its ISO week like "2021-W47".
+func paint(path string, zoom uint8, tilecounts []io.Reader, weeks []string, statistic Statistic, ctx context.Context) error {
+	job := PaintJob{Path: path, FirstWeek: 0, LimitWeek: len(weeks), Statistic: statistic}
+	return paintJobs([]PaintJob{job}, zoom, tilecounts, weeks, ctx)
+}
+
+// MinZoom and maxZoom are the range of supported zoom levels for
+// the pixels of output files. Below minZoom, the world would be smaller
+// than a single tile; beyond maxZoom, the tables of tile offsets and
+// byte counts would need more memory than we are willing to spend.
+const (
+	minZoom = 8
+	maxZoom = 20
+)
+
+// PaintJobs produces a GeoTIFF file for each job, reading the weekly
+// tile view counts only once.
+func paintJobs(jobs []PaintJob, zoom uint8, tilecounts []io.Reader, weeks []string, ctx context.Context) (err error) {
 	logger := log.Default()
-	logger.Printf("starting to paint GeoTIFF, path=%s, zoom=%d", path, zoom)
+	if len(weeks) != len(tilecounts) {
+		return fmt.Errorf("got %d weeks for %d tile logs", len(weeks), len(tilecounts))
+	}
 
-	// One goroutine is decompressing, parsing and merging the weekly counts;
-	// another is painting the image from data that gets sent over a channel.
-	ch := make(chan TileCount, 100000)
-	painter, err := NewPainter(path, len(tilecounts), zoom)
-	if err != nil {
-		return err
+	// For each job, a list of painters that need to be called together.
+	// For a trend job, this is a painter for the recent weeks and another
+	// for the baseline; for all other jobs, it is a single painter.
+	painters := make([][]windowPainter, 0, len(jobs))
+
+	// If painting fails partway, the writers need to stop their
+	// compression workers and remove their temporary files.
+	defer func() {
+		if err != nil {
+			for _, group := range painters {
+				for _, wp := range group {
+					wp.painter.abort()
+				}
+			}
+		}
+	}()
+
+	for _, job := range jobs {
+		if job.FirstWeek < 0 || job.LimitWeek > len(weeks) || job.FirstWeek >= job.LimitWeek {
+			return fmt.Errorf("weeks [%d, %d) out of range for %s", job.FirstWeek, job.LimitWeek, job.Path)
+		}
+		jobZoom := zoom
+		if job.Zoom != 0 {
+			jobZoom = job.Zoom
+		}
+		if jobZoom < minZoom || jobZoom > maxZoom {
+			return fmt.Errorf("zoom %d out of range [%d, %d] for %s", jobZoom, minZoom, maxZoom, job.Path)
+		}
+		logger.Printf("starting to paint GeoTIFF, path=%s, zoom=%d, weeks=%s..%s",
+			job.Path, jobZoom, weeks[job.FirstWeek], weeks[job.LimitWeek-1])
+		if job.isTrend() {
+			if job.BaselineFirstWeek < 0 || job.BaselineLimitWeek > len(weeks) {
+				return fmt.Errorf("baseline weeks [%d, %d) out of range for %s", job.BaselineFirstWeek, job.BaselineLimitWeek, job.Path)
+			}
+			if job.AuxBands || job.Resampling == ResampleSum {
+				return fmt.Errorf("trend output %s cannot have auxiliary bands", job.Path)
+			}
+			logger.Printf("comparing against baseline weeks=%s..%s",
+				weeks[job.BaselineFirstWeek], weeks[job.BaselineLimitWeek-1])
+			writer, err := newTrendWriter(job.Path, jobZoom-8)
+			if err != nil {
+				return err
+			}
+			job.configureWriter(writer.out)
+			recent := newPainterForSink(writer.side(trendRecent), job.Statistic, jobZoom)
+			baseline := newPainterForSink(writer.side(trendBaseline), job.Statistic, jobZoom)
+			painters = append(painters, []windowPainter{
+				{recent, job.FirstWeek, job.LimitWeek},
+				{baseline, job.BaselineFirstWeek, job.BaselineLimitWeek},
+			})
+			recent.resampling, baseline.resampling = job.Resampling, job.Resampling
+		} else {
+			// With sum resampling, the absolute views of each pixel go
+			// into the auxiliary bands, whose overviews sum them up.
+			newPainter := NewPainter
+			if job.AuxBands || job.Resampling == ResampleSum {
+				newPainter = NewAuxPainter
+			}
+			painter, err := newPainter(job.Path, job.Statistic, jobZoom)
+			if err != nil {
+				return err
+			}
+			painter.resampling = job.Resampling
+			job.configureWriter(painter.writer.(*RasterWriter))
+			painters = append(painters, []windowPainter{{painter, job.FirstWeek, job.LimitWeek}})
+		}
 	}
+
+	// One goroutine is decompressing, parsing and merging the weekly counts;
+	// another is painting the images from data that gets sent over a channel.
+	ch := make(chan WeeklyTileCount, 100000)
 	g, subCtx := errgroup.WithContext(ctx)
 	g.Go(func() error {
 		return mergeTileCounts(tilecounts, ch, subCtx)
 	})
 	g.Go(func() error {
 		tile := WorldTile
-		counts := make([]uint64, len(tilecounts))
+		series := NewTileSeries(weeks)
 		numCounts := 0 // number of counts for the same tile
+
+		// Paint the current tile with each painter, passing the
+		// counts of the weeks that are relevant to its job. For
+		// each job, the painters get called if any of them has counts,
+		// which keeps the two painters of a trend job in lockstep.
+		windowCounts := make([][]uint64, 2)
+		flush := func() error {
+			for _, group := range painters {
+				empty := true
+				for i, wp := range group {
+					windowCounts[i] = windowCounts[i][:0]
+					for _, c := range series.Counts[wp.first:wp.limit] {
+						if c > 0 {
+							windowCounts[i] = append(windowCounts[i], c)
+						}
+					}
+					if len(windowCounts[i]) > 0 {
+						empty = false
+					}
+				}
+				if empty {
+					continue
+				}
+				for i, wp := range group {
+					window := &TileSeries{
+						Weeks:  series.Weeks[wp.first:wp.limit],
+						Counts: series.Counts[wp.first:wp.limit],
+					}
+					counts := windowCounts[i]
+					slices.Sort(counts)
+					if err := wp.painter.Paint(tile, counts, window); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		}
+
 		for {
 			select {
 			case <-subCtx.Done():
@@ -170,25 +407,26 @@ func paint(path string, zoom uint8, tilecounts []io.Reader, ctx context.Context)
 			case c, more := <-ch:
 				if c.Key != tile {
 					if numCounts > 0 {
-						if err := painter.Paint(tile, counts[:numCounts]); err != nil {
+						if err := flush(); err != nil {
 							return err
 						}
 					}
 					numCounts = 0
+					series.Reset()
 					tile = c.Key
 				}
 
 				if c.Count > 0 {
-					if numCounts >= len(counts) {
-						return fmt.Errorf("tile %s appears more than %d times in input", tile.String(), len(counts))
+					if numCounts >= len(weeks) {
+						return fmt.Errorf("tile %s appears more than %d times in input", tile.String(), len(weeks))
 					}
-					counts[numCounts] = c.Count
+					series.Counts[c.Week] += c.Count
 					numCounts = numCounts + 1
 				}
 
 				if !more {
 					if numCounts > 0 {
-						if err := painter.Paint(tile, counts[:numCounts]); err != nil {
+						if err := flush(); err != nil {
 							return err
 						}
 					}
@@ -200,8 +438,12 @@ func paint(path string, zoom uint8, tilecounts []io.Reader, ctx context.Context)
 	if err := g.Wait(); err != nil {
 		return err
 	}
-	if err := painter.Close(); err != nil {
-		return err
+	for _, group := range painters {
+		for _, wp := range group {
+			if err := wp.painter.Close(); err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
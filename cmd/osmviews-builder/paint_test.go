@@ -5,13 +5,17 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 
 	"github.com/andybalholm/brotli"
+	"github.com/brawer/osmviews/v2/geotiff"
 )
 
 func TestPaint(t *testing.T) {
@@ -22,7 +26,7 @@ func TestPaint(t *testing.T) {
 	defer file.Close()
 	readers := []io.Reader{brotli.NewReader(file)}
 	path := filepath.Join(t.TempDir(), "zurich.tif")
-	if err := paint(path, 9, readers, context.Background()); err != nil {
+	if err := paint(path, 9, readers, []string{"2021-W47"}, Median, context.Background()); err != nil {
 		t.Fatal(err)
 	}
 }
@@ -32,7 +36,7 @@ func TestPaint(t *testing.T) {
 func TestPaint_ParentNotLogged(t *testing.T) {
 	readers := []io.Reader{strings.NewReader("3/1/1 3\n18/137341/91897 1\n")}
 	path := filepath.Join(t.TempDir(), "notlogged.tif")
-	if err := paint(path, 11, readers, context.Background()); err != nil {
+	if err := paint(path, 11, readers, []string{"2021-W47"}, Median, context.Background()); err != nil {
 		t.Fatal(err)
 	}
 }
@@ -45,7 +49,7 @@ func TestPaint_TooManyCountsForSameTile(t *testing.T) {
 	}
 	path := filepath.Join(t.TempDir(), "toomanycounts.tif")
 	var got string
-	if err := paint(path, 16, readers, context.Background()); err != nil {
+	if err := paint(path, 16, readers, []string{"2021-W47"}, Median, context.Background()); err != nil {
 		got = err.Error()
 	}
 	want := "tile 7/39/87 appears more than 1 times in input"
@@ -53,3 +57,317 @@ func TestPaint_TooManyCountsForSameTile(t *testing.T) {
 		t.Fatalf("got %v, want %v", got, want)
 	}
 }
+
+// Make sure that statistics get told in which week a tile was viewed.
+func TestPaint_Series(t *testing.T) {
+	readers := []io.Reader{
+		strings.NewReader("7/39/87 22\n"),
+		strings.NewReader(""),
+		strings.NewReader("4/2/1 2\n7/39/87 5\n"),
+	}
+	weeks := []string{"2022-W51", "2022-W52", "2023-W01"}
+	got := make(map[string]string)
+	stat := func(counts []uint64, series *TileSeries) float32 {
+		var buf strings.Builder
+		for i, c := range series.Counts {
+			fmt.Fprintf(&buf, " %s:%d", series.Weeks[i], c)
+		}
+		got[fmt.Sprint(counts)] = buf.String()
+		return Median(counts, series)
+	}
+
+	path := filepath.Join(t.TempDir(), "series.tif")
+	if err := paint(path, 16, readers, weeks, stat, context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"[2]":    " 2022-W51:0 2022-W52:0 2023-W01:2",
+		"[5 22]": " 2022-W51:22 2022-W52:0 2023-W01:5",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestPaintJobs(t *testing.T) {
+	readers := []io.Reader{
+		strings.NewReader("7/39/87 22\n"),
+		strings.NewReader("4/2/1 2\n"),
+		strings.NewReader("4/2/1 3\n7/39/87 5\n"),
+	}
+	weeks := []string{"2022-W51", "2022-W52", "2023-W01"}
+	got := make([]string, 0, 4)
+	stat := func(counts []uint64, series *TileSeries) float32 {
+		got = append(got, fmt.Sprint(series.Weeks, counts))
+		return Median(counts, series)
+	}
+
+	dir := t.TempDir()
+	jobs := []PaintJob{
+		{Path: filepath.Join(dir, "first.tif"), FirstWeek: 0, LimitWeek: 1, Statistic: stat},
+		{Path: filepath.Join(dir, "rest.tif"), FirstWeek: 1, LimitWeek: 3, Statistic: stat},
+	}
+	if err := paintJobs(jobs, 16, readers, weeks, context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "[2022-W52 2023-W01] [2 3]|[2022-W51] [22]|[2022-W52 2023-W01] [5]"
+	if strings.Join(got, "|") != want {
+		t.Errorf("got %v, want %v", strings.Join(got, "|"), want)
+	}
+
+	for _, job := range jobs {
+		if _, err := os.Stat(job.Path); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestPaintJobs_Zoom(t *testing.T) {
+	readers := []io.Reader{strings.NewReader("3/1/1 3\n18/137341/91897 1\n20/549364/367588 5\n")}
+	dir := t.TempDir()
+	jobs := []PaintJob{
+		{Path: filepath.Join(dir, "default.tif"), FirstWeek: 0, LimitWeek: 1, Statistic: Median},
+		{Path: filepath.Join(dir, "z8.tif"), FirstWeek: 0, LimitWeek: 1, Statistic: Median, Zoom: 8},
+		{Path: filepath.Join(dir, "z20.tif"), FirstWeek: 0, LimitWeek: 1, Statistic: Median, Zoom: 20},
+	}
+	if err := paintJobs(jobs, 11, readers, []string{"2021-W47"}, context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, want := range []uint8{11, 8, 20} {
+		f, err := os.Open(jobs[i].Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		r, err := geotiff.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.Images[0].Zoom(); got != want {
+			t.Errorf("%s: got zoom %d, want %d", filepath.Base(jobs[i].Path), got, want)
+		}
+		if got := len(r.Images); got != int(want)-7 {
+			t.Errorf("%s: got %d images, want %d", filepath.Base(jobs[i].Path), got, want-7)
+		}
+	}
+
+	// The deepest tile is 20/549364/367588, so at zoom 20
+	// it covers exactly one pixel, in tile 2145/1435.
+	f, err := os.Open(jobs[2].Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := geotiff.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := r.Images[0]
+	data := make([]float32, 256*256)
+	if err := img.ReadTile(1435*img.TilesAcross()+2145, data); err != nil {
+		t.Fatal(err)
+	}
+	if got := data[(367588%256)*256+549364%256]; got <= data[0] {
+		t.Errorf("got pixel %v, want more than background %v", got, data[0])
+	}
+}
+
+func TestPaintJobs_ZoomOutOfRange(t *testing.T) {
+	for _, zoom := range []uint8{7, 21} {
+		readers := []io.Reader{strings.NewReader("3/1/1 3\n")}
+		path := filepath.Join(t.TempDir(), "out.tif")
+		jobs := []PaintJob{{Path: path, FirstWeek: 0, LimitWeek: 1, Statistic: Median, Zoom: zoom}}
+		err := paintJobs(jobs, 18, readers, []string{"2021-W47"}, context.Background())
+		want := fmt.Sprintf("zoom %d out of range [8, 20] for %s", zoom, path)
+		if err == nil || err.Error() != want {
+			t.Errorf("got %v, want %q", err, want)
+		}
+	}
+}
+
+func TestPaintJobs_AuxBands(t *testing.T) {
+	readers := []io.Reader{
+		strings.NewReader("10/500/350 80\n11/1000/700 100\n"),
+		strings.NewReader("11/1000/700 100\n"),
+		strings.NewReader("12/2002/1400 40\n"),
+	}
+	weeks := []string{"2022-W51", "2022-W52", "2023-W01"}
+	path := filepath.Join(t.TempDir(), "aux.tif")
+	job := PaintJob{Path: path, FirstWeek: 0, LimitWeek: 3, Statistic: Max, AuxBands: true}
+	if err := paintJobs([]PaintJob{job}, 11, readers, weeks, context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := geotiff.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img := r.Images[0]
+	if img.SamplesPerPixel != 4 {
+		t.Errorf("got SamplesPerPixel=%d, want 4", img.SamplesPerPixel)
+	}
+	bands := make([][]float32, 4)
+	for band := range bands {
+		bands[band] = make([]float32, 256*256)
+		if err := img.ReadBand(2*img.TilesAcross()+3, band, bands[band]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tc := range []struct {
+		x, y               int
+		weeks, views, zoom float32
+	}{
+		{1000, 700, 2, 120, 11},
+		{1001, 700, 1, 60, 12},
+		{1000, 701, 1, 20, 10},
+		{1003, 700, 0, 0, 0},
+	} {
+		i := (tc.y-512)*256 + tc.x - 768
+		got := fmt.Sprint(bands[1][i], bands[2][i], bands[3][i])
+		want := fmt.Sprint(tc.weeks, tc.views, tc.zoom)
+		if got != want {
+			t.Errorf("pixel (%d, %d): got %s, want %s", tc.x, tc.y, got, want)
+		}
+	}
+	if bands[0][(700-512)*256+1000-768] <= 0 {
+		t.Errorf("got no view density for pixel (1000, 700)")
+	}
+
+	// In the overview, the views of four pixels get summed up.
+	overview := r.Images[1]
+	views := make([]float32, 256*256)
+	if err := overview.ReadBand(1*overview.TilesAcross()+1, 2, views); err != nil {
+		t.Fatal(err)
+	}
+	if got := views[(350-256)*256+500-256]; got != 220 {
+		t.Errorf("got %f views in overview, want 220", got)
+	}
+}
+
+// With sum resampling, the view density gets resampled by area,
+// and the weekly views of the pixels get summed up in a separate band.
+func TestPaintJobs_Sum(t *testing.T) {
+	readers := []io.Reader{strings.NewReader("10/500/350 80\n11/1000/700 100\n11/1001/701 60\n")}
+	weeks := []string{"2023-W01"}
+	path := filepath.Join(t.TempDir(), "sum.tif")
+	job := PaintJob{Path: path, FirstWeek: 0, LimitWeek: 1, Statistic: Max, Resampling: ResampleSum}
+	if err := paintJobs([]PaintJob{job}, 11, readers, weeks, context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := geotiff.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Images[0].SamplesPerPixel; got != 4 {
+		t.Fatalf("got SamplesPerPixel=%d, want 4", got)
+	}
+
+	overview := r.Images[1]
+	bands := make([][]float32, 3)
+	for band := range bands {
+		bands[band] = make([]float32, 256*256)
+		if err := overview.ReadBand(1*overview.TilesAcross()+1, band, bands[band]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	i := (350-256)*256 + 500 - 256
+	if got := bands[2][i]; got != 240 {
+		t.Errorf("got %f views in overview, want 240", got)
+	}
+
+	// The density of the overview pixel is the area-weighted mean
+	// of its four children, so it is on the same scale as at the
+	// deepest zoom level.
+	density := math.Expm1(float64(bands[0][i]))
+	want := 80/TileArea(10, 350) + (100+60)/(2*(TileArea(11, 700)+TileArea(11, 701)))
+	if math.Abs(density-want) > 1e-3*want {
+		t.Errorf("got density %f in overview, want %f", density, want)
+	}
+}
+
+// Different encodings must produce the same pixels, except for
+// lossy LERC compression, whose pixels must be within its maximum error.
+func TestPaintJobs_Encoding(t *testing.T) {
+	file, err := os.Open(filepath.Join("testdata", "zurich-2021-W47.br"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	readers := []io.Reader{brotli.NewReader(file)}
+	dir := t.TempDir()
+	jobs := []PaintJob{
+		{Path: filepath.Join(dir, "plain.tif"), FirstWeek: 0, LimitWeek: 1, Statistic: Median},
+		{Path: filepath.Join(dir, "predictor.tif"), FirstWeek: 0, LimitWeek: 1, Statistic: Median, Predictor: true},
+		{Path: filepath.Join(dir, "zstd.tif"), FirstWeek: 0, LimitWeek: 1, Statistic: Median, Compression: Zstd},
+		{Path: filepath.Join(dir, "zstd-predictor.tif"), FirstWeek: 0, LimitWeek: 1, Statistic: Median, Compression: Zstd, Predictor: true},
+		{Path: filepath.Join(dir, "bigtiff.tif"), FirstWeek: 0, LimitWeek: 1, Statistic: Median, BigTIFF: true},
+		{Path: filepath.Join(dir, "lerc.tif"), FirstWeek: 0, LimitWeek: 1, Statistic: Median, Compression: Lerc, MaxError: 0.01},
+	}
+	if err := paintJobs(jobs, 11, readers, []string{"2021-W47"}, context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	images := make([][]*geotiff.Image, len(jobs))
+	bigTIFF := make([]bool, len(jobs))
+	for i, job := range jobs {
+		f, err := os.Open(job.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		r, err := geotiff.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		images[i] = r.Images
+		bigTIFF[i] = r.BigTIFF
+	}
+	if want := []bool{false, false, false, false, true, false}; !slices.Equal(bigTIFF, want) {
+		t.Errorf("got BigTIFF=%v, want %v", bigTIFF, want)
+	}
+	if got := images[1][0].Predictor; got != 3 {
+		t.Errorf("got Predictor=%d, want 3", got)
+	}
+	if got := images[2][0].Compression; got != 50000 {
+		t.Errorf("got Compression=%d, want 50000", got)
+	}
+	if got := images[5][0].Compression; got != 34887 {
+		t.Errorf("got Compression=%d, want 34887", got)
+	}
+
+	plain := make([]float32, 256*256)
+	encoded := make([]float32, 256*256)
+	for level, img := range images[0] {
+		for tile := range img.TileOffsets {
+			if err := img.ReadTile(tile, plain); err != nil {
+				t.Fatal(err)
+			}
+			for i := 1; i < len(jobs); i++ {
+				if err := images[i][level].ReadTile(tile, encoded); err != nil {
+					t.Fatal(err)
+				}
+				same := slices.EqualFunc(plain, encoded, func(a, b float32) bool {
+					return math.Abs(float64(a-b)) <= jobs[i].MaxError
+				})
+				if !same {
+					t.Fatalf("%s: image %d, tile %d differs", filepath.Base(jobs[i].Path), level, tile)
+				}
+			}
+		}
+	}
+}
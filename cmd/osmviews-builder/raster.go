@@ -5,7 +5,6 @@ package main
 
 import (
 	"bytes"
-	"compress/zlib"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -26,10 +25,45 @@ type Raster struct {
 	parent      *Raster
 	viewsPerKm2 float32
 	pixels      [256 * 256]float32
+	aux         *rasterAux // nil unless the output has auxiliary bands
+}
+
+// RasterAux holds the auxiliary bands of a Raster. They tell apart
+// a genuinely quiet place from a place whose data is sparse and
+// therefore unreliable.
+type rasterAux struct {
+	weeks [256 * 256]float32 // most weeks with views among covering tiles
+	views [256 * 256]float32 // weekly views, apportioned by pixel area
+	zoom  [256 * 256]float32 // deepest zoom of a viewed covering tile
+
+	// Values for the pixels that are covered by the tile of this
+	// raster and its ancestors, but by none of its descendants.
+	uniform auxValues
+}
+
+// AuxValues are the auxiliary band values of a single pixel.
+type auxValues struct {
+	weeks, views, zoom float32
+}
+
+// InitAux allocates the auxiliary bands of a raster. Initially, the
+// pixels inherit the values of the parent’s tile and its ancestors.
+func (r *Raster) initAux() {
+	r.aux = &rasterAux{}
+	if r.parent != nil && r.parent.aux != nil {
+		r.aux.uniform = r.parent.aux.uniform
+		r.aux.uniform.views /= 4
+	}
+	u := r.aux.uniform
+	for i := range r.aux.weeks {
+		r.aux.weeks[i] = u.weeks
+		r.aux.views[i] = u.views
+		r.aux.zoom[i] = u.zoom
+	}
 }
 
 func (r *Raster) Paint(tile TileKey, viewsPerKm2 float32) {
-	rZoom, rX, rY := r.tile.ZoomXY()
+	rZoom := r.tile.Zoom()
 
 	// If the to-be-painted tile is smaller than 1 pixel, we scale it
 	// to one pixel and reduce the number of views accordingly.
@@ -37,16 +71,10 @@ func (r *Raster) Paint(tile TileKey, viewsPerKm2 float32) {
 	// is nearly uniform despite the distortion of the web mercator
 	// projection.
 	if zoom := tile.Zoom(); zoom > rZoom+8 {
-		viewsPerKm2 /= float32(int32(1 << (2 * (zoom - (rZoom + 8)))))
-		tile = tile.ToZoom(rZoom + 8)
+		viewsPerKm2 /= float32(uint64(1) << (2 * (zoom - (rZoom + 8))))
 	}
 
-	zoom, x, y := tile.ZoomXY()
-	deltaZoom := zoom - rZoom
-	left := (x - rX<<deltaZoom) << (8 - deltaZoom)
-	top := (y - rY<<deltaZoom) << (8 - deltaZoom)
-	width := uint32(1 << (8 - deltaZoom))
-	// Because our tiles are squares, the height is the same as the width.
+	left, top, width := r.pixelArea(tile)
 	for y := top; y < top+width; y++ {
 		for x := left; x < left+width; x++ {
 			r.pixels[y<<8+x] += viewsPerKm2
@@ -54,11 +82,52 @@ func (r *Raster) Paint(tile TileKey, viewsPerKm2 float32) {
 	}
 }
 
+// PaintAux paints the auxiliary bands for a tile, given its weekly
+// views and the number of weeks in which it was viewed. Tiles smaller
+// than one pixel contribute all their views to that pixel.
+func (r *Raster) PaintAux(tile TileKey, views float32, weeks float32) {
+	a := r.aux
+	tileZoom := float32(tile.Zoom())
+	if tile == r.tile {
+		a.uniform.weeks = max(a.uniform.weeks, weeks)
+		a.uniform.views += views / (256 * 256)
+		a.uniform.zoom = max(a.uniform.zoom, tileZoom)
+	}
+
+	left, top, width := r.pixelArea(tile)
+	viewsPerPixel := views / float32(width*width)
+	for y := top; y < top+width; y++ {
+		for x := left; x < left+width; x++ {
+			i := y<<8 + x
+			a.weeks[i] = max(a.weeks[i], weeks)
+			a.views[i] += viewsPerPixel
+			a.zoom[i] = max(a.zoom[i], tileZoom)
+		}
+	}
+}
+
+// PixelArea returns the square of pixels covered by a tile. If the tile
+// is smaller than a pixel, the result is the pixel containing the tile.
+func (r *Raster) pixelArea(tile TileKey) (left, top, width uint32) {
+	rZoom, rX, rY := r.tile.ZoomXY()
+	if tile.Zoom() > rZoom+8 {
+		tile = tile.ToZoom(rZoom + 8)
+	}
+	zoom, x, y := tile.ZoomXY()
+	deltaZoom := zoom - rZoom
+	left = (x - rX<<deltaZoom) << (8 - deltaZoom)
+	top = (y - rY<<deltaZoom) << (8 - deltaZoom)
+	// Because our tiles are squares, the height is the same as the width.
+	width = uint32(1 << (8 - deltaZoom))
+	return left, top, width
+}
+
 // PaintChild subsamples a child raster into the parent. Called when a child
 // is finished painting, this is used for constructing overview images
 // in the output GeoTIFF. Child must be an immediate child of r, exactly
-// one zoom level deeper.
-func (r *Raster) PaintChild(child *Raster) {
+// one zoom level deeper. Each parent pixel gets computed from a 2×2 block
+// of child pixels, as specified by resampling.
+func (r *Raster) PaintChild(child *Raster, resampling Resampling) {
 	if child.parent != r {
 		panic(fmt.Sprintf("child %v has wrong parent %v, expected %v", child.tile, child.parent.tile, r.tile))
 	}
@@ -71,18 +140,43 @@ func (r *Raster) PaintChild(child *Raster) {
 
 	x0, y0 := (cx-(px<<1))*128, (cy-(py<<1))*128
 	for y := uint32(0); y < 256; y += 2 {
+		// For area weighting, all pixels in the same row have the same
+		// area, so we only need the areas of the two rows.
+		var upperArea, lowerArea float32
+		if resampling == ResampleArea || resampling == ResampleSum {
+			upperArea = float32(TileArea(czoom+8, cy<<8+y))
+			lowerArea = float32(TileArea(czoom+8, cy<<8+y+1))
+		}
 		for x := uint32(0); x < 256; x += 2 {
-			max := child.pixels[y<<8+x]
-			if p := child.pixels[(y+0)<<8+(x+1)]; p > max {
-				max = p
-			}
-			if p := child.pixels[(y+1)<<8+(x+0)]; p > max {
-				max = p
-			}
-			if p := child.pixels[(y+1)<<8+(x+1)]; p > max {
-				max = p
+			ul, ur := child.pixels[y<<8+x], child.pixels[y<<8+x+1]
+			ll, lr := child.pixels[(y+1)<<8+x], child.pixels[(y+1)<<8+x+1]
+			var val float32
+			switch resampling {
+			case ResampleMean:
+				val = (ul + ur + ll + lr) / 4
+			case ResampleArea, ResampleSum:
+				val = (upperArea*(ul+ur) + lowerArea*(ll+lr)) / (2 * (upperArea + lowerArea))
+			default:
+				val = max(ul, ur, ll, lr)
 			}
-			r.pixels[(y0+y>>1)<<8+(x0+x>>1)] = max
+			r.pixels[(y0+y>>1)<<8+(x0+x>>1)] = val
+		}
+	}
+
+	// For the auxiliary bands, the weeks and zoom of an overview pixel
+	// are the maximum of its four children, and the views their sum.
+	if r.aux == nil || child.aux == nil {
+		return
+	}
+	a, c := r.aux, child.aux
+	for y := uint32(0); y < 256; y += 2 {
+		for x := uint32(0); x < 256; x += 2 {
+			i := y<<8 + x
+			j := i + 256
+			p := (y0+y>>1)<<8 + (x0 + x>>1)
+			a.weeks[p] = max(c.weeks[i], c.weeks[i+1], c.weeks[j], c.weeks[j+1])
+			a.views[p] = c.views[i] + c.views[i+1] + c.views[j] + c.views[j+1]
+			a.zoom[p] = max(c.zoom[i], c.zoom[i+1], c.zoom[j], c.zoom[j+1])
 		}
 	}
 }
@@ -111,13 +205,44 @@ type RasterWriter struct {
 	dataSize     uint64
 	zoom         uint8
 	maxValue     float32
+	description  string
+
+	// Signed outputs, such as trends, store their pixel values as given
+	// instead of logarithmizing them. For these, minSample and maxSample
+	// are the range of stored values.
+	signed    bool
+	minSample float32
+	maxSample float32
+
+	// Outputs with auxiliary bands have four samples per pixel,
+	// interleaved in the order of auxBandNames; auxMax is the
+	// maximum value of the auxiliary bands.
+	bands  int
+	auxMax auxValues
+
+	// If predictor is set, tiles get encoded with the TIFF
+	// floating-point predictor before compression. With LERC
+	// compression, maxError is the largest allowed difference
+	// between a stored sample and its original value.
+	predictor   bool
+	compression Compression
+	maxError    float64
+
+	// If bigTIFF is set, the output is a BigTIFF file with 64-bit
+	// offsets. Otherwise, writing fails if the output exceeds 4 GiB.
+	bigTIFF bool
 
 	// For each zoom level, tileOffsets is the position of the TileOffset
 	// relative to the start of the temporary file. In the final output,
 	// we need to group together the tiles from the same zoom level.
-	tileOffsets    [][]uint32
+	tileOffsets    [][]uint64
 	tileByteCounts [][]uint32
 	uniformTiles   []map[uint32]int
+	uniformAux     []map[uniformAuxKey]int
+	sharedTiles    []sharedTile
+
+	// Compressor is running while tiles are being written.
+	compressor *compressor
 
 	// For each zoom level, tileOffsetsPos is the position of the pointer
 	// to the tileOffsets array within the Image File Directory,
@@ -138,23 +263,73 @@ func NewRasterWriter(path string, zoom uint8) (*RasterWriter, error) {
 		path:              path,
 		tempFile:          tempFile,
 		zoom:              zoom,
-		tileOffsets:       make([][]uint32, zoom+1),
+		bands:             1,
+		compression:       Deflate,
+		description:       "OpenStreetMap view density, in weekly user views per km2",
+		tileOffsets:       make([][]uint64, zoom+1),
 		tileByteCounts:    make([][]uint32, zoom+1),
 		uniformTiles:      make([]map[uint32]int, zoom+1),
+		uniformAux:        make([]map[uniformAuxKey]int, zoom+1),
 		ifdPos:            make([]int64, zoom+1),
 		nextIFDPos:        make([]int64, zoom+1),
 		tileOffsetsPos:    make([]int64, zoom+1),
 		tileByteCountsPos: make([]int64, zoom+1),
 	}
 	for z := uint8(0); z <= zoom; z++ {
-		r.tileOffsets[z] = make([]uint32, 1<<(2*z))
+		r.tileOffsets[z] = make([]uint64, 1<<(2*z))
 		r.tileByteCounts[z] = make([]uint32, 1<<(2*z))
 		r.uniformTiles[z] = make(map[uint32]int, 16)
+		r.uniformAux[z] = make(map[uniformAuxKey]int, 16)
 	}
 	return r, nil
 }
 
+// NewSignedRasterWriter returns a RasterWriter for signed pixel values,
+// which get stored without any transformation. Such outputs must be
+// written with WriteSigned and WriteSignedUniform.
+func NewSignedRasterWriter(path string, zoom uint8, description string) (*RasterWriter, error) {
+	w, err := NewRasterWriter(path, zoom)
+	if err != nil {
+		return nil, err
+	}
+	w.signed = true
+	w.description = description
+	return w, nil
+}
+
+// Names of the bands in outputs with auxiliary bands. The first band
+// is the same as in single-band outputs.
+var auxBandNames = []string{
+	"ln(1 + weekly views per km2)",
+	"weeks with views",
+	"weekly views",
+	"deepest zoom level with views",
+}
+
+// NewAuxRasterWriter returns a RasterWriter whose output has auxiliary
+// bands next to the view density. Such outputs must be written with
+// rasters that have auxiliary bands.
+func NewAuxRasterWriter(path string, zoom uint8) (*RasterWriter, error) {
+	w, err := NewRasterWriter(path, zoom)
+	if err != nil {
+		return nil, err
+	}
+	w.bands = len(auxBandNames)
+	return w, nil
+}
+
+// UniformAuxKey identifies the shared data of uniform rasters
+// in outputs with auxiliary bands.
+type uniformAuxKey struct {
+	color uint32
+	aux   auxValues
+}
+
 func (w *RasterWriter) Write(r *Raster) error {
+	if w.bands > 1 {
+		return w.writeAux(r)
+	}
+
 	// About 124K rasters are not strictly uniform, but they have only
 	// marginal differences in color. For those, we can save the effort
 	// of compression.
@@ -184,17 +359,13 @@ func (w *RasterWriter) Write(r *Raster) error {
 	for i := 0; i < 256*256; i++ {
 		logPixels[i] = float32(math.Log1p(float64(r.pixels[i])))
 	}
-	offset, size, err := w.compress(r.tile, logPixels[:])
-	if err != nil {
-		return err
-	}
-
-	zoom, x, y := r.tile.ZoomXY()
-	tileIndex := (1<<zoom)*y + x
-	w.tileOffsets[zoom][tileIndex] = uint32(offset)
-	w.tileByteCounts[zoom][tileIndex] = size
+	return w.submit(r.tile, logPixels[:])
+}
 
-	return nil
+// WriteUniformDensity produces a uniform raster for a view density,
+// rounded to the nearest color.
+func (w *RasterWriter) WriteUniformDensity(tile TileKey, viewsPerKm2 float32) error {
+	return w.WriteUniform(tile, uint32(viewsPerKm2+0.5))
 }
 
 // WriteUniform produces a raster whose pixels all have the same color.
@@ -204,8 +375,7 @@ func (w *RasterWriter) WriteUniform(tile TileKey, color uint32) error {
 	zoom, x, y := tile.ZoomXY()
 	tileIndex := (1<<zoom)*y + x
 	if same, exists := w.uniformTiles[zoom][color]; exists {
-		w.tileOffsets[zoom][tileIndex] = w.tileOffsets[zoom][same]
-		w.tileByteCounts[zoom][tileIndex] = w.tileByteCounts[zoom][same]
+		w.share(zoom, tileIndex, uint32(same))
 		return nil
 	}
 	col := float32(color)
@@ -217,42 +387,164 @@ func (w *RasterWriter) WriteUniform(tile TileKey, color uint32) error {
 	for i := 0; i < len(pixels); i++ {
 		pixels[i] = logCol
 	}
-	offset, size, err := w.compress(tile, pixels[:])
-	if err != nil {
+	if err := w.submit(tile, pixels[:]); err != nil {
 		return err
 	}
-	w.tileOffsets[zoom][tileIndex] = uint32(offset)
-	w.tileByteCounts[zoom][tileIndex] = size
 	w.uniformTiles[zoom][color] = int(tileIndex)
 	return nil
 }
 
-func (w *RasterWriter) compress(tile TileKey, pixels []float32) (offset uint64, size uint32, err error) {
-	var compressed bytes.Buffer
-	writer, err := zlib.NewWriterLevel(&compressed, zlib.BestCompression)
-	if err != nil {
-		return 0, 0, err
+func (w *RasterWriter) writeAux(r *Raster) error {
+	a := r.aux
+	if a == nil {
+		return fmt.Errorf("raster %s has no auxiliary bands", r.tile)
 	}
 
-	if err := binary.Write(writer, binary.LittleEndian, pixels); err != nil {
-		return 0, 0, err
+	uniform := true
+	color := uint32(r.pixels[0] + 0.5)
+	u := auxValues{weeks: a.weeks[0], views: a.views[0], zoom: a.zoom[0]}
+	for i := range r.pixels {
+		w.maxValue = max(w.maxValue, r.pixels[i])
+		w.auxMax.weeks = max(w.auxMax.weeks, a.weeks[i])
+		w.auxMax.views = max(w.auxMax.views, a.views[i])
+		w.auxMax.zoom = max(w.auxMax.zoom, a.zoom[i])
+		if uniform && (uint32(r.pixels[i]+0.5) != color || a.weeks[i] != u.weeks || a.views[i] != u.views || a.zoom[i] != u.zoom) {
+			uniform = false
+		}
+	}
+	if uniform {
+		return w.WriteUniformAux(r.tile, color, u)
 	}
 
-	if err := writer.Close(); err != nil {
-		return 0, 0, err
+	samples := make([]float32, 4*256*256)
+	for i := range r.pixels {
+		samples[4*i] = float32(math.Log1p(float64(r.pixels[i])))
+		samples[4*i+1] = a.weeks[i]
+		samples[4*i+2] = a.views[i]
+		samples[4*i+3] = a.zoom[i]
 	}
+	return w.submit(r.tile, samples)
+}
 
-	n, err := compressed.WriteTo(w.tempFile)
-	if err != nil {
-		return 0, 0, err
+// WriteUniformAux produces a raster whose pixels all have the same
+// color and auxiliary values, in an output with auxiliary bands.
+// Like with WriteUniform, the compressed data is shared among all
+// tiles of the same values.
+func (w *RasterWriter) WriteUniformAux(tile TileKey, color uint32, aux auxValues) error {
+	zoom, x, y := tile.ZoomXY()
+	tileIndex := (1<<zoom)*y + x
+	key := uniformAuxKey{color, aux}
+	if same, exists := w.uniformAux[zoom][key]; exists {
+		w.share(zoom, tileIndex, uint32(same))
+		return nil
+	}
+	w.maxValue = max(w.maxValue, float32(color))
+	w.auxMax.weeks = max(w.auxMax.weeks, aux.weeks)
+	w.auxMax.views = max(w.auxMax.views, aux.views)
+	w.auxMax.zoom = max(w.auxMax.zoom, aux.zoom)
+	logCol := float32(math.Log1p(float64(color)))
+	samples := make([]float32, 4*256*256)
+	for i := 0; i < len(samples); i += 4 {
+		samples[i] = logCol
+		samples[i+1] = aux.weeks
+		samples[i+2] = aux.views
+		samples[i+3] = aux.zoom
+	}
+	if err := w.submit(tile, samples); err != nil {
+		return err
 	}
+	w.uniformAux[zoom][key] = int(tileIndex)
+	return nil
+}
 
-	offset = w.tempFileSize
-	w.tempFileSize += uint64(n)
-	return offset, uint32(n), nil
+// WriteSigned stores the pixels of a tile into a signed output.
+// Because the pixels get compressed in the background, the caller
+// must not modify them afterwards.
+func (w *RasterWriter) WriteSigned(tile TileKey, pixels []float32) error {
+	for _, p := range pixels {
+		w.minSample = min(w.minSample, p)
+		w.maxSample = max(w.maxSample, p)
+	}
+	return w.submit(tile, pixels)
+}
+
+// WriteSignedUniform stores a tile whose pixels all have the same value
+// into a signed output. Like with WriteUniform, the compressed data
+// is shared among all tiles of the same value.
+func (w *RasterWriter) WriteSignedUniform(tile TileKey, value float32) error {
+	zoom, x, y := tile.ZoomXY()
+	tileIndex := (1<<zoom)*y + x
+	key := math.Float32bits(value)
+	if same, exists := w.uniformTiles[zoom][key]; exists {
+		w.share(zoom, tileIndex, uint32(same))
+		return nil
+	}
+	var pixels [256 * 256]float32
+	for i := range pixels {
+		pixels[i] = value
+	}
+	if err := w.WriteSigned(tile, pixels[:]); err != nil {
+		return err
+	}
+	w.uniformTiles[zoom][key] = int(tileIndex)
+	return nil
+}
+
+// Encode converts samples into the compressed form that gets stored
+// in the TIFF file. This is called concurrently on worker goroutines.
+func (w *RasterWriter) encode(samples []float32) ([]byte, error) {
+	if w.compression == Lerc {
+		return encodeLerc(samples, 256, 256, w.bands, w.maxError), nil
+	}
+
+	var data []byte
+	if w.predictor {
+		data = predictFloats(samples, 256*w.bands, w.bands)
+	} else {
+		var err error
+		if data, err = binary.Append(nil, binary.LittleEndian, samples); err != nil {
+			return nil, err
+		}
+	}
+
+	var compressed bytes.Buffer
+	if err := w.compression.compress(&compressed, data); err != nil {
+		return nil, err
+	}
+	return compressed.Bytes(), nil
+}
+
+// PredictFloats applies the TIFF floating-point predictor to rows of
+// float32 samples. In each row, the bytes of the samples get grouped
+// by significance, starting with the most significant byte of every
+// sample; then, each byte gets replaced by its difference to the byte
+// one pixel earlier. Neighboring pixels tend to have similar values,
+// so this produces long runs of zero bytes which zlib compresses well.
+// https://chriscox.org/TIFFTN3d1.pdf
+func predictFloats(samples []float32, rowSamples int, stride int) []byte {
+	result := make([]byte, 4*len(samples))
+	for start := 0; start < len(samples); start += rowSamples {
+		row := samples[start : start+rowSamples]
+		out := result[4*start : 4*(start+rowSamples)]
+		for i, s := range row {
+			bits := math.Float32bits(s)
+			out[i] = byte(bits >> 24)
+			out[rowSamples+i] = byte(bits >> 16)
+			out[2*rowSamples+i] = byte(bits >> 8)
+			out[3*rowSamples+i] = byte(bits)
+		}
+		for i := len(out) - 1; i >= stride; i-- {
+			out[i] -= out[i-stride]
+		}
+	}
+	return result
 }
 
 func (w *RasterWriter) Close() error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+
 	out, err := os.Create(w.path + ".tmp")
 	if err != nil {
 		return err
@@ -275,6 +567,7 @@ func (w *RasterWriter) Close() error {
 	if err := w.tempFile.Close(); err != nil {
 		return err
 	}
+	w.tempFile = nil
 	if err := os.Remove(tempFileName); err != nil {
 		return err
 	}
@@ -283,10 +576,16 @@ func (w *RasterWriter) Close() error {
 }
 
 func (w *RasterWriter) writeTiff(out *os.File) error {
-	// Magic header for a little-endian TIFF file that is smaller than 4GiB.
-	// Our output is “only” a few hundred megabytes, so we do not need to
-	// care about BigTIFF.
+	// Magic header for a little-endian TIFF file. Classic TIFF is limited
+	// to 4 GiB.
+	// Our main output is “only” a few hundred megabytes, but variants at
+	// deeper zoom levels or with more bands can be larger. For those,
+	// we write BigTIFF, whose header has 8-byte offsets.
+	// https://www.awaresystems.be/imaging/tiff/bigtiff.html
 	magic := []byte{'I', 'I', 42, 0}
+	if w.bigTIFF {
+		magic = []byte{'I', 'I', 43, 0, 8, 0, 0, 0}
+	}
 	if _, err := out.Write(magic); err != nil {
 		return err
 	}
@@ -294,7 +593,7 @@ func (w *RasterWriter) writeTiff(out *os.File) error {
 	// Offset to first Image File Directory in file. This gets overwritten
 	// by writeIFDList(), once the actual IFD position is known. But we need
 	// to allocate space for the offset here.
-	if err := binary.Write(out, binary.LittleEndian, uint32(0)); err != nil {
+	if _, err := out.Write(make([]byte, w.offsetSize())); err != nil {
 		return err
 	}
 
@@ -364,14 +663,18 @@ func (w *RasterWriter) writeIFD(zoom uint8, f *os.File) error {
 		imageDescription = 270
 		samplesPerPixel  = 277
 		planarConfig     = 284
+		predictor        = 317
 		software         = 305
 		tileWidth        = 322
 		tileLength       = 323
 		tileOffsets      = 324
 		tileByteCounts   = 325
+		extraSamples     = 338
 		sampleFormat     = 339
 		sMinSampleValue  = 340
 		sMaxSampleValue  = 341
+		gdalMetadata     = 42112
+		lercParameters   = 50674
 
 		modelPixelScale = 33550
 		modelTiepoint   = 33922
@@ -383,6 +686,7 @@ func (w *RasterWriter) writeIFD(zoom uint8, f *os.File) error {
 		longFormat   = 4
 		floatFormat  = 11
 		doubleFormat = 12
+		long8Format  = 16 // BigTIFF only
 	)
 
 	fileSize, err := f.Seek(0, io.SeekEnd)
@@ -425,9 +729,9 @@ func (w *RasterWriter) writeIFD(zoom uint8, f *os.File) error {
 		{imageWidth, 1 << (zoom + 8)},
 		{imageHeight, 1 << (zoom + 8)},
 		{bitsPerSample, 32},
-		{compression, 8}, // 1 = no compression; 8 = zlib/flate
-		{photometric, 0}, // 0 = WhiteIsZero
-		{samplesPerPixel, 1},
+		{compression, uint32(w.compression)}, // 8 = zlib/flate; 50000 = zstd; 34887 = LERC
+		{photometric, 0},                     // 0 = WhiteIsZero
+		{samplesPerPixel, uint32(w.bands)},
 		{planarConfig, 1},
 		{tileWidth, 256},
 		{tileLength, 256},
@@ -436,6 +740,23 @@ func (w *RasterWriter) writeIFD(zoom uint8, f *os.File) error {
 		{sampleFormat, 3}, // 3 = IEEE floating point, TIFF spec page 80
 	}
 
+	if w.predictor {
+		ifd = append(ifd, ifdEntry{predictor, 3}) // 3 = floating point, TIFF Technical Note 3
+	}
+	if w.compression == Lerc {
+		ifd = append(ifd, ifdEntry{lercParameters, 0})
+	}
+
+	// The auxiliary bands are not color channels, so TIFF readers
+	// need to be told that they are extra samples of unspecified
+	// meaning. GDAL shows their names from the GDAL_METADATA tag.
+	if w.bands > 1 {
+		ifd = append(ifd, ifdEntry{extraSamples, 0})
+		if zoom == w.zoom {
+			ifd = append(ifd, ifdEntry{gdalMetadata, 0})
+		}
+	}
+
 	// Some TIFF tags are only used on the main (highest resolution) image.
 	if zoom == w.zoom {
 		ifd = append(ifd, ifdEntry{imageDescription, 0})
@@ -454,20 +775,30 @@ func (w *RasterWriter) writeIFD(zoom uint8, f *os.File) error {
 
 	sort.Slice(ifd, func(i, j int) bool { return ifd[i].tag < ifd[j].tag })
 
+	// In classic TIFF, an IFD has a 2-byte entry count, 12-byte entries
+	// and a 4-byte offset to the next IFD. In BigTIFF, these are 8 bytes,
+	// 20 bytes and 8 bytes. Values that fit into 4 bytes (classic) or
+	// 8 bytes (BigTIFF) are stored inline in the IFD entry.
+	countSize, entrySize, valueSize := 2, 12, 4
+	if w.bigTIFF {
+		countSize, entrySize, valueSize = 8, 20, 8
+	}
+
 	// Position of extra data that does not fit inline in Image File Directory,
 	// relative to start of TIFF file.
-	extraPos := fileSize + int64(2+len(ifd)*12+4)
+	extraPos := fileSize + int64(countSize+len(ifd)*entrySize+valueSize)
 
 	var buf, extraBuf bytes.Buffer
-	if err := binary.Write(&buf, binary.LittleEndian, uint16(len(ifd))); err != nil {
+	if err := writeUint(&buf, countSize, uint64(len(ifd))); err != nil {
 		return err
 	}
 
+	le := binary.LittleEndian
 	lastTag := uint16(0)
 	for i, e := range ifd {
-		// Compute the position of the currently written IFD entry,
-		// relative to the start of the output TIFF file.
-		ifdEntryPos := fileSize + int64(2+i*12) // 2 bytes for number of entries
+		// Compute the position of the value field of the currently
+		// written IFD entry, relative to the start of the output TIFF file.
+		valuePos := fileSize + int64(countSize+i*entrySize+entrySize-valueSize)
 
 		// Sanity check that our tags appear in the Image File Directory
 		// in increasing order, as required by the TIFF specification.
@@ -476,94 +807,157 @@ func (w *RasterWriter) writeIFD(zoom uint8, f *os.File) error {
 		}
 		lastTag = e.tag
 
-		if err := binary.Write(&buf, binary.LittleEndian, e.tag); err != nil {
-			return err
-		}
+		// For each entry, we compute the encoded values; below, they get
+		// stored either inline or into the extra data after the IFD.
 		var typ uint16
-		var count, value uint32
+		var count uint64
+		var data []byte
 		switch e.tag {
 		case newSubfileType:
-			typ, count, value = longFormat, 1, e.val
+			typ, count, data = longFormat, 1, le.AppendUint32(nil, e.val)
 
-		case imageDescription:
-			s := []byte("OpenStreetMap view density, in weekly user views per km2\u0000")
-			typ, count, value = asciiFormat, uint32(len(s)), uint32(extraPos)+uint32(extraBuf.Len())
-			if _, err := extraBuf.Write(s); err != nil {
-				return err
+		case bitsPerSample, sampleFormat:
+			typ, count = shortFormat, uint64(w.bands)
+			for i := 0; i < w.bands; i++ {
+				data = le.AppendUint16(data, uint16(e.val))
+			}
+
+		case lercParameters:
+			// Version 4 of the LERC blob format, without any further
+			// compression of the blobs. This is the same as GDAL writes.
+			typ, count = longFormat, 2
+			data = le.AppendUint32(le.AppendUint32(nil, lercVersion), 0)
+
+		case extraSamples:
+			// 0 = unspecified data, TIFF spec page 31
+			typ, count, data = shortFormat, uint64(w.bands-1), make([]byte, 2*(w.bands-1))
+
+		case gdalMetadata:
+			var meta strings.Builder
+			meta.WriteString("<GDALMetadata>")
+			for i, name := range auxBandNames {
+				fmt.Fprintf(&meta, `<Item name="DESCRIPTION" sample="%d" role="description">%s</Item>`, i, name)
 			}
+			meta.WriteString("</GDALMetadata>\u0000")
+			data = []byte(meta.String())
+			typ, count = asciiFormat, uint64(len(data))
+
+		case imageDescription:
+			data = []byte(w.description + "\u0000")
+			typ, count = asciiFormat, uint64(len(data))
 
 		case software:
-			var softwareBuf bytes.Buffer
-			softwareBuf.WriteString(SoftwareVersion)
-			softwareBuf.WriteByte(0)
-			s := softwareBuf.Bytes()
-			typ, count, value = asciiFormat, uint32(len(s)), uint32(extraPos)+uint32(extraBuf.Len())
-			extraBuf.Write(s)
+			data = []byte(SoftwareVersion + "\u0000")
+			typ, count = asciiFormat, uint64(len(data))
 
 		case sMinSampleValue:
-			typ, count = floatFormat, 1
-			logMinSampleValue := math.Log1p(0.0)
-			value = math.Float32bits(float32(logMinSampleValue))
+			mins := []float32{float32(math.Log1p(0.0))}
+			if w.signed {
+				mins[0] = w.minSample
+			}
+			if w.bands > 1 {
+				mins = make([]float32, w.bands)
+			}
+			typ, count = floatFormat, uint64(len(mins))
+			if data, err = binary.Append(nil, le, mins); err != nil {
+				return err
+			}
 
 		case sMaxSampleValue:
-			typ, count = floatFormat, 1
-			logMaxSampleValue := math.Log1p(float64(w.maxValue))
-			value = math.Float32bits(float32(logMaxSampleValue))
+			logMaxSampleValue := float32(math.Log1p(float64(w.maxValue)))
+			maxs := []float32{logMaxSampleValue}
+			if w.signed {
+				maxs[0] = w.maxSample
+			}
+			if w.bands > 1 {
+				maxs = []float32{logMaxSampleValue, w.auxMax.weeks, w.auxMax.views, w.auxMax.zoom}
+			}
+			typ, count = floatFormat, uint64(len(maxs))
+			if data, err = binary.Append(nil, le, maxs); err != nil {
+				return err
+			}
 
 		case geoKeyDirectory:
-			typ, count, value = shortFormat, uint32(len(geoKeys)), uint32(extraPos)+uint32(extraBuf.Len())
-			if err := binary.Write(&extraBuf, binary.LittleEndian, geoKeys); err != nil {
+			typ, count = shortFormat, uint64(len(geoKeys))
+			if data, err = binary.Append(nil, le, geoKeys); err != nil {
 				return err
 			}
 
 		case modelPixelScale:
-			typ, count, value = doubleFormat, uint32(len(geoModelPixelScale)), uint32(extraPos)+uint32(extraBuf.Len())
-			if err := binary.Write(&extraBuf, binary.LittleEndian, geoModelPixelScale); err != nil {
+			typ, count = doubleFormat, uint64(len(geoModelPixelScale))
+			if data, err = binary.Append(nil, le, geoModelPixelScale); err != nil {
 				return err
 			}
 
 		case modelTiepoint:
-			typ, count, value = doubleFormat, uint32(len(geoModelTiepoints)), uint32(extraPos)+uint32(extraBuf.Len())
-			if err := binary.Write(&extraBuf, binary.LittleEndian, geoModelTiepoints); err != nil {
+			typ, count = doubleFormat, uint64(len(geoModelTiepoints))
+			if data, err = binary.Append(nil, le, geoModelTiepoints); err != nil {
 				return err
 			}
 
 		case geoAsciiParams:
-			s := []byte(geoAscii)
-			typ, count, value = asciiFormat, uint32(len(s)), uint32(extraPos)+uint32(extraBuf.Len())
-			if _, err := extraBuf.Write(s); err != nil {
-				return err
-			}
+			data = []byte(geoAscii)
+			typ, count = asciiFormat, uint64(len(data))
 
 		case tileOffsets:
-			typ, count, value = longFormat, numTiles, 0xdeadbeef
-			w.tileOffsetsPos[zoom] = ifdEntryPos + 8
+			// The offsets get filled in by writeTiles(), once known.
+			typ, count = longFormat, uint64(numTiles)
+			if w.bigTIFF {
+				typ = long8Format
+			}
+			w.tileOffsetsPos[zoom] = valuePos
 
 		case tileByteCounts:
-			typ, count, value = longFormat, numTiles, 0xdeadbeef
-			w.tileByteCountsPos[zoom] = ifdEntryPos + 8
+			// The byte counts get filled in by writeTileByteCounts().
+			typ, count = longFormat, uint64(numTiles)
+			w.tileByteCountsPos[zoom] = valuePos
 
 		default:
-			typ, count, value = longFormat, uint32(1), e.val
+			typ, count, data = longFormat, 1, le.AppendUint32(nil, e.val)
 			if e.val <= 0xffff {
-				typ = shortFormat
+				typ, data = shortFormat, le.AppendUint16(nil, uint16(e.val))
 			}
 		}
-		if err := binary.Write(&buf, binary.LittleEndian, typ); err != nil {
+
+		if err := binary.Write(&buf, le, e.tag); err != nil {
 			return err
 		}
-		if err := binary.Write(&buf, binary.LittleEndian, count); err != nil {
+		if err := binary.Write(&buf, le, typ); err != nil {
 			return err
 		}
-		if err := binary.Write(&buf, binary.LittleEndian, value); err != nil {
+		if err := writeUint(&buf, valueSize, count); err != nil {
 			return err
 		}
+
+		value := make([]byte, valueSize)
+		switch {
+		case data == nil:
+			// Placeholder for TileOffsets and TileByteCounts.
+			for i := range value {
+				value[i] = 0xff
+			}
+
+		case len(data) <= valueSize:
+			copy(value, data)
+
+		default:
+			// TIFF requires word alignment for values outside the IFD.
+			if err := addPadding(&extraBuf); err != nil {
+				return err
+			}
+			if w.bigTIFF {
+				le.PutUint64(value, uint64(extraPos)+uint64(extraBuf.Len()))
+			} else {
+				le.PutUint32(value, uint32(extraPos)+uint32(extraBuf.Len()))
+			}
+			extraBuf.Write(data)
+		}
+		buf.Write(value)
 	}
 
-	nextIFD := uint32(0)
 	nextIFDPos := fileSize + int64(buf.Len())
 	w.nextIFDPos[zoom] = nextIFDPos
-	if err := binary.Write(&buf, binary.LittleEndian, nextIFD); err != nil {
+	if err := writeUint(&buf, valueSize, 0); err != nil {
 		return err
 	}
 
@@ -587,19 +981,35 @@ func (w *RasterWriter) writeIFD(zoom uint8, f *os.File) error {
 	return nil
 }
 
+// WriteUint writes an unsigned integer of 2, 4 or 8 bytes
+// in little-endian byte order.
+func writeUint(buf *bytes.Buffer, size int, value uint64) error {
+	switch size {
+	case 2:
+		return binary.Write(buf, binary.LittleEndian, uint16(value))
+	case 4:
+		return binary.Write(buf, binary.LittleEndian, uint32(value))
+	default:
+		return binary.Write(buf, binary.LittleEndian, value)
+	}
+}
+
 // writeIFDList sets up a linked list of TIFF Image File Directories,
 // ranging from most detailed image to coarsest overview.
 func (w *RasterWriter) writeIFDList(f io.WriteSeeker) error {
 	pos := int64(4)
+	if w.bigTIFF {
+		pos = 8
+	}
 	for zoom := int(w.zoom); zoom >= 0; zoom-- {
 		if w.ifdPos[zoom] != 0 {
-			if err := patchOffset(f, pos, w.ifdPos[zoom]); err != nil {
+			if err := w.patchOffset(f, pos, w.ifdPos[zoom]); err != nil {
 				return err
 			}
 			pos = w.nextIFDPos[zoom]
 		}
 	}
-	if err := patchOffset(f, pos, 0); err != nil {
+	if err := w.patchOffset(f, pos, 0); err != nil {
 		return err
 	}
 	return nil
@@ -636,13 +1046,13 @@ func (w *RasterWriter) writeTiles(zoom uint8, f *os.File) error {
 	// once we know the actual offset of each tile.
 	tileOffsetsPos := fileSize
 	numRows := 1 << zoom
-	emptyRow := make([]byte, numRows*4)
+	emptyRow := make([]byte, numRows*w.offsetSize())
 	for y := 0; y < numRows; y++ {
 		if _, err := f.Write(emptyRow); err != nil {
 			return err
 		}
 	}
-	fileSize += int64(numTiles * 4)
+	fileSize += int64(numTiles) * int64(w.offsetSize())
 
 	// w.uniformTiles[zoom] maps a pixel color to the index,
 	// in TileOffsets and TileByteCounts, of a compressed tile
@@ -659,13 +1069,16 @@ func (w *RasterWriter) writeTiles(zoom uint8, f *os.File) error {
 	// tile data (whose data starts at offset t in the temporary file)
 	// in the final output TIFF file. This array gets populated
 	// when actually writing the output to the output TIFF.
-	uniform := make(map[uint32]bool, len(w.uniformTiles[zoom]))
-	uniformPos := make(map[uint32]uint32, len(w.uniformTiles[zoom]))
+	uniform := make(map[uint64]bool, len(w.uniformTiles[zoom]))
+	uniformPos := make(map[uint64]uint64, len(w.uniformTiles[zoom]))
 	for _, t := range w.uniformTiles[zoom] {
 		uniform[w.tileOffsets[zoom][t]] = true
 	}
+	for _, t := range w.uniformAux[zoom] {
+		uniform[w.tileOffsets[zoom][t]] = true
+	}
 
-	finalTileOffsets := make([]uint32, numTiles)
+	finalTileOffsets := make([]uint64, numTiles)
 	for tile := uint32(0); tile < numTiles; tile++ {
 		tileOffset := w.tileOffsets[zoom][tile] // offset in temp file
 		if unipos, exists := uniformPos[tileOffset]; !exists {
@@ -703,7 +1116,10 @@ func (w *RasterWriter) writeTiles(zoom uint8, f *os.File) error {
 			// not support the “tile data leader and trailer” convention.
 			copy(data[len(data)-4:], payload[len(payload)-4:])
 
-			finalTileOffset := uint32(fileSize) + 4
+			finalTileOffset := uint64(fileSize) + 4
+			if !w.bigTIFF && finalTileOffset+uint64(tileSize) > 0xffffffff {
+				return fmt.Errorf("%s exceeds 4 GiB, which needs BigTIFF", w.path)
+			}
 			finalTileOffsets[tile] = finalTileOffset
 			if uniform[tileOffset] {
 				uniformPos[tileOffset] = finalTileOffset
@@ -718,27 +1134,28 @@ func (w *RasterWriter) writeTiles(zoom uint8, f *os.File) error {
 	}
 
 	if len(finalTileOffsets) == 1 {
-		if _, err := f.Seek(w.tileOffsetsPos[zoom], io.SeekStart); err != nil {
-			return err
-		}
-		if err := binary.Write(f, binary.LittleEndian, finalTileOffsets[0]); err != nil {
-			return err
-		}
-
-		return nil
+		return w.patchOffset(f, w.tileOffsetsPos[zoom], int64(finalTileOffsets[0]))
 	}
 
 	if _, err := f.Seek(tileOffsetsPos, io.SeekStart); err != nil {
 		return err
 	}
 
-	if err := binary.Write(f, binary.LittleEndian, finalTileOffsets); err != nil {
+	var offsets any = finalTileOffsets
+	if !w.bigTIFF {
+		offsets32 := make([]uint32, len(finalTileOffsets))
+		for i, off := range finalTileOffsets {
+			offsets32[i] = uint32(off)
+		}
+		offsets = offsets32
+	}
+	if err := binary.Write(f, binary.LittleEndian, offsets); err != nil {
 		return err
 	}
 
 	// Patch up the Image File Directory so its TileOffsets entry points
 	// to the freshly written TileOffsets array.
-	if err := patchOffset(f, w.tileOffsetsPos[zoom], tileOffsetsPos); err != nil {
+	if err := w.patchOffset(f, w.tileOffsetsPos[zoom], tileOffsetsPos); err != nil {
 		return err
 	}
 
@@ -758,13 +1175,7 @@ func (w *RasterWriter) writeTileByteCounts(zoom uint8, f io.WriteSeeker) error {
 	// If the TileByteCounts array has just one single entry, it fits into
 	// the Image File Directory and _has_ to be inlined (as per TIFF spec).
 	if len(sizes) == 1 {
-		if _, err := f.Seek(pos, io.SeekStart); err != nil {
-			return err
-		}
-		if err := binary.Write(f, binary.LittleEndian, sizes); err != nil {
-			return err
-		}
-		return nil
+		return w.patchOffset(f, pos, int64(sizes[0]))
 	}
 
 	arrayPos, err := f.Seek(0, io.SeekEnd)
@@ -786,7 +1197,7 @@ func (w *RasterWriter) writeTileByteCounts(zoom uint8, f io.WriteSeeker) error {
 		return err
 	}
 
-	if err := patchOffset(f, pos, arrayPos); err != nil {
+	if err := w.patchOffset(f, pos, arrayPos); err != nil {
 		return err
 	}
 
@@ -803,13 +1214,32 @@ func addPadding(buf *bytes.Buffer) error {
 	return nil
 }
 
+// OffsetSize returns the size of file offsets in the output, in bytes.
+func (w *RasterWriter) offsetSize() int {
+	if w.bigTIFF {
+		return 8
+	}
+	return 4
+}
+
+// PatchOffset overwrites the file offset at position pos with value,
+// in the offset size of the output.
+func (w *RasterWriter) patchOffset(f io.WriteSeeker, pos int64, value int64) error {
+	if !w.bigTIFF {
+		return patchOffset(f, pos, value)
+	}
+	if _, err := f.Seek(pos, io.SeekStart); err != nil {
+		return err
+	}
+	return binary.Write(f, binary.LittleEndian, uint64(value))
+}
+
+// PatchOffset overwrites the four-byte file offset at position pos.
+// Classic TIFF files cannot address more than 4 GiB; when value
+// does not fit, the output needs to be written as BigTIFF.
 func patchOffset(f io.WriteSeeker, pos int64, value int64) error {
 	if value < 0 || value > 0xffffffff {
-		// If this triggers, there probably is a bug in the code that has
-		// calculatied the passed value. If we really had to deal with
-		// file offsets above 2^32, we could implement BigTIFF, but this
-		// seems rather unlikely because our data size is not that large.
-		panic("offset value out of range")
+		return fmt.Errorf("offset %d out of range for classic TIFF, which needs BigTIFF", value)
 	}
 
 	if _, err := f.Seek(pos, io.SeekStart); err != nil {
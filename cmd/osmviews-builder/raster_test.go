@@ -38,11 +38,21 @@ func TestRaster_Paint_SubPixel(t *testing.T) {
 	})
 }
 
+// Tile logs go down to zoom 24, which is 16 zoom levels deeper than
+// the pixels of a world raster at the coarsest supported output zoom.
+func TestRaster_Paint_DeepSubPixel(t *testing.T) {
+	r := NewRaster(WorldTile, nil)
+	r.Paint(MakeTileKey(24, 0, 0), 65536*65536)
+	if got := r.pixels[0]; got != 1 {
+		t.Errorf("got %v, want 1", got)
+	}
+}
+
 func TestRaster_PaintChild(t *testing.T) {
 	r := NewRaster(MakeTileKey(1, 1, 1), NewRaster(WorldTile, nil))
 	r.pixels[1] = 123456
 	r.pixels[256] = 789123
-	r.parent.PaintChild(r)
+	r.parent.PaintChild(r, ResampleMax)
 	wantPixels(t, r.parent.pixels, [4][4]float32{
 		{0, 0, 0, 0},
 		{0, 0, 0, 0},
@@ -51,6 +61,144 @@ func TestRaster_PaintChild(t *testing.T) {
 	})
 }
 
+func TestRaster_PaintChild_Resampling(t *testing.T) {
+	for _, tc := range []struct {
+		resampling Resampling
+		want       float32
+	}{
+		{ResampleMax, 8},
+		{ResampleMean, 3.75},
+	} {
+		r := NewRaster(MakeTileKey(1, 1, 1), NewRaster(WorldTile, nil))
+		r.pixels[0], r.pixels[1], r.pixels[256], r.pixels[257] = 1, 2, 4, 8
+		r.parent.PaintChild(r, tc.resampling)
+		if got := r.parent.pixels[128<<8+128]; got != tc.want {
+			t.Errorf("%s: got %f, want %f", tc.resampling, got, tc.want)
+		}
+	}
+}
+
+// A quadrant painted from a child raster must be on the same scale
+// as a neighbouring quadrant whose children were all uniform, where the
+// overview keeps the density of the parent raster.
+func TestRaster_PaintChild_UniformNeighbour(t *testing.T) {
+	for _, resampling := range []Resampling{ResampleMax, ResampleMean, ResampleArea, ResampleSum} {
+		parent := NewRaster(WorldTile, nil)
+		parent.Paint(WorldTile, 0.3)
+		r := NewRaster(MakeTileKey(1, 1, 1), parent)
+		for i := range r.pixels {
+			r.pixels[i] = 0.3
+		}
+		parent.PaintChild(r, resampling)
+		uniform, painted := parent.pixels[0], parent.pixels[128<<8+128]
+		if math.Abs(float64(painted-uniform)) > 1e-6 {
+			t.Errorf("%s: got %f next to uniform %f, want same", resampling, painted, uniform)
+		}
+	}
+}
+
+// With area-weighted resampling, overviews preserve the total number
+// of views, even though the pixels in the web mercator projection
+// cover different areas depending on their latitude.
+func TestRaster_PaintChild_Area(t *testing.T) {
+	for _, resampling := range []Resampling{ResampleArea, ResampleSum} {
+		testPaintChildArea(t, resampling)
+	}
+}
+
+func testPaintChildArea(t *testing.T, resampling Resampling) {
+	r := NewRaster(MakeTileKey(1, 1, 1), NewRaster(WorldTile, nil))
+	for i := range r.pixels {
+		r.pixels[i] = float32(i % 97)
+	}
+	r.parent.PaintChild(r, resampling)
+
+	var childViews, parentViews float64
+	for y := uint32(0); y < 256; y++ {
+		area := TileArea(9, 256+y)
+		for x := uint32(0); x < 256; x++ {
+			childViews += float64(r.pixels[y<<8+x]) * area
+		}
+	}
+	for y := uint32(128); y < 256; y++ {
+		area := TileArea(8, y)
+		for x := uint32(128); x < 256; x++ {
+			parentViews += float64(r.parent.pixels[y<<8+x]) * area
+		}
+	}
+	if math.Abs(childViews-parentViews) > 1e-5*childViews {
+		t.Errorf("%s: got %f views in overview, want %f", resampling, parentViews, childViews)
+	}
+}
+
+func TestRaster_PaintAux(t *testing.T) {
+	r := NewRaster(MakeTileKey(1, 1, 1), NewRaster(WorldTile, nil))
+	r.parent.initAux()
+	r.parent.PaintAux(WorldTile, 4*256*256, 3)
+	r.initAux()
+	r.PaintAux(MakeTileKey(2, 3, 3), 4*128*128, 2)
+	r.PaintAux(MakeTileKey(10, 1023, 1023), 7, 5) // covers 1/4th of a pixel
+	wantPixels(t, r.aux.weeks, [4][4]float32{
+		{3, 3, 3, 3},
+		{3, 3, 3, 3},
+		{3, 3, 3, 3},
+		{3, 3, 3, 3},
+	})
+	wantPixels(t, r.aux.views, [4][4]float32{
+		{1, 1, 1, 1},
+		{1, 1, 1, 1},
+		{1, 1, 5, 5},
+		{1, 1, 5, 5},
+	})
+	if got := r.aux.views[255<<8+255]; got != 12 {
+		t.Errorf("got views=%f for sub-pixel tile, want 12", got)
+	}
+	wantPixels(t, r.aux.zoom, [4][4]float32{
+		{0, 0, 0, 0},
+		{0, 0, 0, 0},
+		{0, 0, 2, 2},
+		{0, 0, 2, 2},
+	})
+	if got := r.aux.weeks[255<<8+255]; got != 5 {
+		t.Errorf("got weeks=%f for sub-pixel tile, want 5", got)
+	}
+	if got := r.aux.zoom[255<<8+255]; got != 10 {
+		t.Errorf("got zoom=%f for sub-pixel tile, want 10", got)
+	}
+}
+
+func TestRaster_PaintChild_Aux(t *testing.T) {
+	r := NewRaster(MakeTileKey(1, 1, 1), NewRaster(WorldTile, nil))
+	r.parent.initAux()
+	r.initAux()
+	r.aux.weeks[0], r.aux.weeks[257] = 7, 9
+	r.aux.views[0], r.aux.views[1], r.aux.views[256] = 1, 2, 4
+	r.aux.zoom[1] = 18
+	r.parent.PaintChild(r, ResampleMax)
+	p := r.parent.aux
+	if got := p.weeks[128<<8+128]; got != 9 {
+		t.Errorf("got weeks=%f, want 9", got)
+	}
+	if got := p.views[128<<8+128]; got != 7 {
+		t.Errorf("got views=%f, want 7", got)
+	}
+	if got := p.zoom[128<<8+128]; got != 18 {
+		t.Errorf("got zoom=%f, want 18", got)
+	}
+}
+
+func TestPredictFloats(t *testing.T) {
+	// 1.0 is 0x3f800000 and 1.5 is 0x3fc00000 in IEEE 754.
+	got := predictFloats([]float32{1.0, 1.5, 1.0, 1.5}, 2, 1)
+	want := []byte{
+		0x3f, 0x00, 0x41, 0x40, 0x40, 0x00, 0x00, 0x00,
+		0x3f, 0x00, 0x41, 0x40, 0x40, 0x00, 0x00, 0x00,
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("got %x, want %x", got, want)
+	}
+}
+
 func wantPixels(t *testing.T, got [256 * 256]float32, want [4][4]float32) {
 	px := []int{0, 64, 128, 192}
 	for j, vals := range want {
@@ -224,3 +372,35 @@ func TestRasterWriter_patchOffset(t *testing.T) {
 		t.Errorf("got %v, want %v", got, want)
 	}
 }
+
+func TestRasterWriter_patchOffset_bigTIFF(t *testing.T) {
+	f := &writerseeker.WriterSeeker{}
+	if _, err := f.Write([]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}); err != nil {
+		t.Fatal(err)
+	}
+	w := &RasterWriter{bigTIFF: true}
+	if err := w.patchOffset(f, 3, 0x1beefcafe); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := io.ReadAll(f.Reader())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []byte{0, 1, 2, 0xfe, 0xca, 0xef, 0xbe, 1, 0, 0, 0, 11, 12}
+	if string(got) != string(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestRasterWriter_patchOffset_tooLarge(t *testing.T) {
+	f := &writerseeker.WriterSeeker{}
+	if _, err := f.Write([]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}); err != nil {
+		t.Fatal(err)
+	}
+	w := &RasterWriter{}
+	if err := w.patchOffset(f, 3, 0x1beefcafe); err == nil {
+		t.Error("want error for offset beyond 4 GiB in classic TIFF")
+	}
+}
@@ -0,0 +1,63 @@
+// SPDX-FileCopyrightText: 2026 Sascha Brawer <sascha@brawer.ch>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import "fmt"
+
+// Resampling tells how the pixels of overview images get computed
+// from the 2×2 blocks of pixels at the next deeper zoom level.
+type Resampling int
+
+const (
+	// ResampleMax takes the highest of the four pixels. This keeps
+	// small hotspots visible on zoomed-out maps, but it overstates
+	// the views of larger regions.
+	ResampleMax Resampling = iota
+
+	// ResampleMean takes the arithmetic mean of the four pixels.
+	ResampleMean
+
+	// ResampleArea takes the mean of the four pixels, weighted by their
+	// area in km². Because pixels hold views per km², this preserves
+	// the total number of views across zoom levels, which makes it
+	// the right choice for statistics over large regions.
+	ResampleArea
+
+	// ResampleSum resamples the view density like ResampleArea, and
+	// additionally stores the absolute weekly views of each pixel in
+	// a separate band, which overviews sum up. This keeps the density
+	// on the same scale at all zoom levels, while the sums can be
+	// read directly for large regions such as countries.
+	ResampleSum
+)
+
+// ParseResampling returns the Resampling for a name such as "max",
+// "mean", "area" or "sum".
+func ParseResampling(name string) (Resampling, error) {
+	switch name {
+	case "max":
+		return ResampleMax, nil
+	case "mean":
+		return ResampleMean, nil
+	case "area":
+		return ResampleArea, nil
+	case "sum":
+		return ResampleSum, nil
+	}
+	return ResampleMax, fmt.Errorf("unknown resampling: %q", name)
+}
+
+func (r Resampling) String() string {
+	switch r {
+	case ResampleMax:
+		return "max"
+	case ResampleMean:
+		return "mean"
+	case ResampleArea:
+		return "area"
+	case ResampleSum:
+		return "sum"
+	}
+	return fmt.Sprintf("Resampling(%d)", int(r))
+}
@@ -0,0 +1,28 @@
+// SPDX-FileCopyrightText: 2026 Sascha Brawer <sascha@brawer.ch>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"testing"
+)
+
+func TestParseResampling(t *testing.T) {
+	for _, name := range []string{"max", "mean", "area", "sum"} {
+		r, err := ParseResampling(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.String(); got != name {
+			t.Errorf("got %q, want %q", got, name)
+		}
+	}
+}
+
+func TestParseResampling_Invalid(t *testing.T) {
+	for _, name := range []string{"", "Max", "average", "nearest"} {
+		if _, err := ParseResampling(name); err == nil {
+			t.Errorf("ParseResampling(%q) should fail", name)
+		}
+	}
+}
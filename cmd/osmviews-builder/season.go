@@ -0,0 +1,70 @@
+// SPDX-FileCopyrightText: 2026 Sascha Brawer <sascha@brawer.ch>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Season is a calendar period, such as a quarter or a month, for which
+// the builder produces a separate GeoTIFF file. Unlike the median over
+// an entire year, this shows seasonal effects in tourism, for example
+// that alpine regions peak in winter and coastal regions in summer.
+type Season struct {
+	Name      string // such as "2026Q3" or "2026-07"
+	FirstWeek int    // index of the first week of the season
+	LimitWeek int    // index after the last week of the season
+}
+
+// FindSeasons returns the seasons that are completely covered by a list
+// of ISO weeks, in chronological order. As in ISO 8601, a week belongs
+// to the month of its Thursday. The period is "quarter" or "month".
+func FindSeasons(weeks []string, period string) ([]Season, error) {
+	var label func(t time.Time) string
+	switch period {
+	case "quarter":
+		label = func(t time.Time) string {
+			return fmt.Sprintf("%04dQ%d", t.Year(), (int(t.Month())+2)/3)
+		}
+	case "month":
+		label = func(t time.Time) string {
+			return t.Format("2006-01")
+		}
+	default:
+		return nil, fmt.Errorf("unknown season period: %q", period)
+	}
+
+	thursdays := make([]time.Time, 0, len(weeks))
+	for _, w := range weeks {
+		year, week, err := ParseWeek(w)
+		if err != nil {
+			return nil, err
+		}
+		thursdays = append(thursdays, weekStart(year, week).AddDate(0, 0, 3))
+	}
+
+	seasons := make([]Season, 0, 5)
+	for first := 0; first < len(weeks); {
+		name := label(thursdays[first])
+		limit := first + 1
+		complete := label(thursdays[first].AddDate(0, 0, -7)) != name
+		for limit < len(weeks) && label(thursdays[limit]) == name {
+			// If the server is missing the tile logs for some week,
+			// the season is incomplete.
+			if !thursdays[limit].Equal(thursdays[limit-1].AddDate(0, 0, 7)) {
+				complete = false
+			}
+			limit++
+		}
+		if label(thursdays[limit-1].AddDate(0, 0, 7)) == name {
+			complete = false
+		}
+		if complete {
+			seasons = append(seasons, Season{Name: name, FirstWeek: first, LimitWeek: limit})
+		}
+		first = limit
+	}
+	return seasons, nil
+}
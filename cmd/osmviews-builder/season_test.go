@@ -0,0 +1,57 @@
+// SPDX-FileCopyrightText: 2026 Sascha Brawer <sascha@brawer.ch>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestFindSeasons(t *testing.T) {
+	weeks := []string{"2025-W50", "2025-W51", "2025-W52"}
+	for w := 1; w <= 30; w++ {
+		weeks = append(weeks, fmt.Sprintf("2026-W%02d", w))
+	}
+
+	for _, tc := range []struct {
+		period string
+		want   string
+	}{
+		{"quarter", "[{2026Q1 3 16} {2026Q2 16 29}]"},
+		{"month", "[{2026-01 3 8} {2026-02 8 12} {2026-03 12 16} {2026-04 16 21} {2026-05 21 25} {2026-06 25 29}]"},
+	} {
+		seasons, err := FindSeasons(weeks, tc.period)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(seasons); got != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.period, got, tc.want)
+		}
+	}
+}
+
+// If the tile logs for a week are missing, the seasons
+// containing that week are incomplete.
+func TestFindSeasons_MissingWeek(t *testing.T) {
+	weeks := make([]string, 0, 30)
+	for w := 1; w <= 30; w++ {
+		weeks = append(weeks, fmt.Sprintf("2026-W%02d", w))
+	}
+	weeks = slices.Delete(weeks, 4, 5) // 2026-W05
+
+	seasons, err := FindSeasons(weeks, "quarter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fmt.Sprint(seasons), "[{2026Q2 12 25}]"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestFindSeasons_BadPeriod(t *testing.T) {
+	if _, err := FindSeasons([]string{"2026-W01"}, "fortnight"); err == nil {
+		t.Error("expected error for unknown period")
+	}
+}
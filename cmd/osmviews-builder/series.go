@@ -0,0 +1,33 @@
+// SPDX-FileCopyrightText: 2026 Sascha Brawer <sascha@brawer.ch>
+// SPDX-License-Identifier: MIT
+
+package main
+
+// TileSeries holds the weekly view counts for a tile, in chronological
+// order. Unlike the sorted counts that get passed to a Statistic, it tells
+// in which week a tile was viewed how often, and which weeks had no views.
+type TileSeries struct {
+	// Weeks are the ISO weeks, such as "2021-W47", whose tile logs got
+	// merged, from oldest to most recent. All tiles share the same slice.
+	Weeks []string
+
+	// Counts[i] is the number of views in Weeks[i], or zero if the tile
+	// was not viewed in that week.
+	Counts []uint64
+}
+
+// NewTileSeries returns an empty TileSeries for a list of ISO weeks.
+func NewTileSeries(weeks []string) *TileSeries {
+	return &TileSeries{Weeks: weeks, Counts: make([]uint64, len(weeks))}
+}
+
+// Len returns the number of weeks in the series.
+func (s *TileSeries) Len() int {
+	return len(s.Counts)
+}
+
+// Reset sets all weekly counts to zero, so the series can be re-used
+// for the next tile.
+func (s *TileSeries) Reset() {
+	clear(s.Counts)
+}
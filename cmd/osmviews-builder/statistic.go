@@ -0,0 +1,152 @@
+// SPDX-FileCopyrightText: 2026 Sascha Brawer <sascha@brawer.ch>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+)
+
+// A Statistic summarizes the weekly view counts of a tile into a single
+// number. The counts are sorted in ascending order. Weeks in which
+// a tile has not been viewed at all do not appear in counts, so
+// len(counts) can be smaller than series.Len(); the missing weeks
+// count as zero views. Statistics that depend on the order of weeks
+// can use the series, which has the counts in chronological order.
+type Statistic func(counts []uint64, series *TileSeries) float32
+
+var percentileRegexp = regexp.MustCompile(`^p([1-9][0-9]?)$`)
+var trimmedMeanRegexp = regexp.MustCompile(`^trimmed([1-4]?[0-9])$`)
+var decayRegexp = regexp.MustCompile(`^decay([1-9][0-9]{0,2})$`)
+
+// ParseStatistic returns the Statistic for a name such as "median",
+// "mean", "max", "p90" for the 90th percentile, "trimmed10" for
+// the mean after discarding the lowest and highest 10% of weeks,
+// or "decay8" for an exponentially weighted mean whose weights
+// halve every 8 weeks.
+func ParseStatistic(name string) (Statistic, error) {
+	switch name {
+	case "median":
+		return Median, nil
+	case "mean":
+		return Mean, nil
+	case "max":
+		return Max, nil
+	}
+
+	if m := percentileRegexp.FindStringSubmatch(name); m != nil {
+		p, _ := strconv.Atoi(m[1])
+		return Percentile(float64(p) / 100.0), nil
+	}
+
+	if m := trimmedMeanRegexp.FindStringSubmatch(name); m != nil {
+		p, _ := strconv.Atoi(m[1])
+		return TrimmedMean(float64(p) / 100.0), nil
+	}
+
+	if m := decayRegexp.FindStringSubmatch(name); m != nil {
+		halfLife, _ := strconv.Atoi(m[1])
+		return ExponentialDecay(float64(halfLife)), nil
+	}
+
+	return nil, fmt.Errorf("unknown statistic: %q", name)
+}
+
+// Median returns the median of the weekly view counts. For an even
+// number of weeks, this is the upper of the two middle values.
+func Median(counts []uint64, series *TileSeries) float32 {
+	numWeeks := series.Len()
+	return weeklyCount(counts, numWeeks, numWeeks/2)
+}
+
+// Mean returns the arithmetic mean of the weekly view counts.
+func Mean(counts []uint64, series *TileSeries) float32 {
+	numWeeks := series.Len()
+	if numWeeks <= 0 {
+		return 0
+	}
+	var sum float64
+	for _, c := range counts {
+		sum += float64(c)
+	}
+	return float32(sum / float64(numWeeks))
+}
+
+// Max returns the highest weekly view count.
+func Max(counts []uint64, series *TileSeries) float32 {
+	if len(counts) == 0 {
+		return 0
+	}
+	return float32(counts[len(counts)-1])
+}
+
+// Percentile returns a Statistic for the q-th quantile of the
+// weekly view counts, with q in the range 0 to 1. Percentile(0.5)
+// is the same as Median.
+func Percentile(q float64) Statistic {
+	return func(counts []uint64, series *TileSeries) float32 {
+		numWeeks := series.Len()
+		pos := int(q * float64(numWeeks))
+		if pos >= numWeeks {
+			pos = numWeeks - 1
+		}
+		return weeklyCount(counts, numWeeks, pos)
+	}
+}
+
+// TrimmedMean returns a Statistic for the mean of the weekly view
+// counts, after discarding the fraction `trim` of the lowest and of
+// the highest weeks. This is less sensitive to outliers than Mean,
+// such as a single week in which a place was in the news.
+func TrimmedMean(trim float64) Statistic {
+	return func(counts []uint64, series *TileSeries) float32 {
+		numWeeks := series.Len()
+		cut := int(trim * float64(numWeeks))
+		if numWeeks-2*cut <= 0 {
+			return Median(counts, series)
+		}
+		var sum float64
+		for pos := cut; pos < numWeeks-cut; pos++ {
+			sum += float64(weeklyCount(counts, numWeeks, pos))
+		}
+		return float32(sum / float64(numWeeks-2*cut))
+	}
+}
+
+// ExponentialDecay returns a Statistic for the weighted mean of the
+// weekly view counts, where the weight of a week halves every
+// `halfLife` weeks back in time. Compared to a short window, this
+// follows trends quickly while still smoothing over weekly noise.
+func ExponentialDecay(halfLife float64) Statistic {
+	return func(counts []uint64, series *TileSeries) float32 {
+		numWeeks := series.Len()
+		weight := func(week int) float64 {
+			return math.Exp2(-float64(numWeeks-1-week) / halfLife)
+		}
+		var sum, totalWeight float64
+		for week := 0; week < numWeeks; week++ {
+			totalWeight += weight(week)
+		}
+		if totalWeight == 0 {
+			return 0
+		}
+		for week, c := range series.Counts {
+			sum += float64(c) * weight(week)
+		}
+		return float32(sum / totalWeight)
+	}
+}
+
+// WeeklyCount returns the view count at position `pos` when all
+// weekly counts, including the weeks without views, are sorted
+// in ascending order.
+func weeklyCount(counts []uint64, numWeeks int, pos int) float32 {
+	pos -= numWeeks - len(counts)
+	if pos < 0 || pos >= len(counts) {
+		return 0
+	}
+	return float32(counts[pos])
+}
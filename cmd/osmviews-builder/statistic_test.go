@@ -0,0 +1,87 @@
+// SPDX-FileCopyrightText: 2026 Sascha Brawer <sascha@brawer.ch>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"testing"
+)
+
+func TestStatistic(t *testing.T) {
+	// Five weeks of data; in two other weeks, there were no views.
+	counts := []uint64{1, 2, 3, 4, 90}
+	series := &TileSeries{
+		Weeks:  []string{"2021-W47", "2021-W48", "2021-W49", "2021-W50", "2021-W51", "2021-W52", "2022-W01"},
+		Counts: []uint64{2, 4, 0, 3, 0, 90, 1},
+	}
+	for _, tc := range []struct {
+		name string
+		want float32
+	}{
+		{"median", 2},
+		{"mean", 100.0 / 7.0},
+		{"max", 90},
+		{"p10", 0},
+		{"p50", 2},
+		{"p90", 90},
+		{"p99", 90},
+		{"trimmed0", 100.0 / 7.0},
+		{"trimmed15", 10.0 / 5.0},
+		{"trimmed49", 2},
+		{"decay1", 2978.0 / 127.0},
+	} {
+		stat, err := ParseStatistic(tc.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := stat(counts, series); got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestStatistic_NoViews(t *testing.T) {
+	for _, name := range []string{"median", "mean", "max", "p90", "trimmed10", "decay8"} {
+		stat, err := ParseStatistic(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := stat(nil, NewTileSeries(make([]string, 52))); got != 0 {
+			t.Errorf("%s: got %v, want 0", name, got)
+		}
+	}
+}
+
+// Median must compute the same value as the painter did before
+// the statistic became configurable, so the default product stays
+// unchanged.
+func TestMedian(t *testing.T) {
+	for numWeeks := 1; numWeeks <= 8; numWeeks++ {
+		for numCounts := 1; numCounts <= numWeeks; numCounts++ {
+			counts := make([]uint64, numCounts)
+			for i := range counts {
+				counts[i] = uint64(10 * (i + 1))
+			}
+			var want float32
+			if pos := numWeeks/2 - (numWeeks - numCounts); pos >= 0 {
+				want = float32(counts[pos])
+			}
+			series := NewTileSeries(make([]string, numWeeks))
+			copy(series.Counts[numWeeks-numCounts:], counts)
+			if got := Median(counts, series); got != want {
+				t.Errorf("Median(%v, %d): got %v, want %v", counts, numWeeks, got, want)
+			}
+			if got := Percentile(0.5)(counts, series); got != want {
+				t.Errorf("Percentile(0.5)(%v, %d): got %v, want %v", counts, numWeeks, got, want)
+			}
+		}
+	}
+}
+
+func TestParseStatistic_Invalid(t *testing.T) {
+	for _, name := range []string{"", "Median", "p0", "p100", "p5x", "trimmed50", "trimmed", "decay0", "decay"} {
+		if _, err := ParseStatistic(name); err == nil {
+			t.Errorf("ParseStatistic(%q) should fail", name)
+		}
+	}
+}
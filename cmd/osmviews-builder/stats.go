@@ -11,6 +11,7 @@ import (
 	"os"
 	"sort"
 
+	"github.com/brawer/osmviews/v2/geotiff"
 	"github.com/fogleman/gg"
 )
 
@@ -21,12 +22,12 @@ func BuildStats(tiffPath, statsPath, plotPath string) error {
 	}
 	defer f.Close()
 
-	t, err := NewTiffReader(f)
+	t, err := geotiff.NewReader(f)
 	if err != nil {
 		return err
 	}
 
-	hist, err := buildHistogram(t)
+	hist, err := buildHistogram(t.Images[0])
 	if err != nil {
 		return err
 	}
@@ -77,7 +78,7 @@ type Stats struct {
 
 type TileIndex int
 
-func (s SharedTiles) Plot(dc *gg.Context, tileOffsets []uint32) {
+func (s SharedTiles) Plot(dc *gg.Context, tileOffsets []uint64) {
 	dc.SetRGB(1, 1, 1)
 	dc.Clear()
 
@@ -100,7 +101,7 @@ func (s SharedTiles) Plot(dc *gg.Context, tileOffsets []uint32) {
 }
 
 type histogramBuilder struct {
-	tiff                    *TiffReader
+	tiff                    *geotiff.Image
 	imageWidth, imageHeight uint32
 	tileWidth, tileHeight   uint32
 	stride                  uint32
@@ -116,14 +117,14 @@ type Bucket struct {
 	Sample BucketSample
 }
 
-func newHistogramBuilder(tiff *TiffReader) *histogramBuilder {
+func newHistogramBuilder(tiff *geotiff.Image) *histogramBuilder {
 	h := &histogramBuilder{
 		tiff:       tiff,
-		imageWidth: tiff.imageWidth, imageHeight: tiff.imageHeight, tileWidth: tiff.tileWidth, tileHeight: tiff.tileHeight}
+		imageWidth: tiff.Width, imageHeight: tiff.Height, tileWidth: tiff.TileWidth, tileHeight: tiff.TileHeight}
 
-	h.stride = (tiff.imageWidth + tiff.tileWidth - 1) / tiff.tileWidth
-	h.zoom = math.Ilogb(float64(tiff.imageWidth))
-	h.tileWidthBits = math.Ilogb(float64(tiff.tileWidth))
+	h.stride = (tiff.Width + tiff.TileWidth - 1) / tiff.TileWidth
+	h.zoom = math.Ilogb(float64(tiff.Width))
+	h.tileWidthBits = math.Ilogb(float64(tiff.TileWidth))
 	h.buckets = make(map[uint64]Bucket, 250000) // 210037 for 2022-01-24 data
 	return h
 }
@@ -177,21 +178,21 @@ func (h *histogramBuilder) Plot(dc *gg.Context, buckets []Bucket) {
 	fmt.Println("**** Number of unique lat/lng samples:", len(ctr))
 }
 
-func buildHistogram(t *TiffReader) ([]Bucket, error) {
-	sharedTiles := findSharedTiles(t.tileOffsets)
-	stride := 1 << (math.Ilogb(float64(len(t.tileOffsets))) / 2)
+func buildHistogram(t *geotiff.Image) ([]Bucket, error) {
+	sharedTiles := findSharedTiles(t.TileOffsets)
+	stride := 1 << (math.Ilogb(float64(len(t.TileOffsets))) / 2)
 	hist := newHistogramBuilder(t)
-	data := make([]float32, t.tileWidth*t.tileHeight)
+	data := make([]float32, t.TileWidth*t.TileHeight)
 	nn := 0
 	for _, y := range rand.Perm(stride) {
 		for _, x := range rand.Perm(stride) {
 			ti := TileIndex(y*stride + x)
-			off := t.tileOffsets[ti]
+			off := t.TileOffsets[ti]
 			if _, isShared := sharedTiles[off]; isShared {
 				continue
 			}
 			// if nn > 8 { break }
-			if err := t.ReadTile(int(ti), data); err != nil {
+			if err := t.ReadBand(int(ti), 0, data); err != nil {
 				return nil, err
 			}
 			hist.Add(data, 1, []TileIndex{ti})
@@ -205,7 +206,7 @@ func buildHistogram(t *TiffReader) ([]Bucket, error) {
 	}
 
 	for _, st := range sharedTiles {
-		if err := t.ReadTile(int(st.SampleTiles[0]), data); err != nil {
+		if err := t.ReadBand(int(st.SampleTiles[0]), 0, data); err != nil {
 			return nil, err
 		}
 		tileUses := int64(st.UseCount) * int64(len(data))
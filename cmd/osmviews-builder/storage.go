@@ -7,11 +7,15 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
+	"mime"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
 	"sort"
+	"strings"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
@@ -33,8 +37,9 @@ type Storage interface {
 }
 
 // RemoteStorage is an implementation of interface Storage that talks
-// to a remote S3-compatible server. The other implementation is FakeStorage,
-// which is used for testing.
+// to a remote S3-compatible server. The other implementations are
+// localStorage, for running the pipeline without an S3 service,
+// and FakeStorage, which is used for testing.
 type remoteStorage struct {
 	client *minio.Client
 }
@@ -76,9 +81,186 @@ func (s *remoteStorage) Remove(ctx context.Context, bucket, path string) error {
 	return s.client.RemoveObject(ctx, bucket, path, minio.RemoveObjectOptions{})
 }
 
+// LocalStorage is an implementation of interface Storage that keeps
+// objects in a directory tree on the local file system. Each bucket
+// is a subdirectory of the root, and object keys are relative paths
+// within the bucket directory.
+type localStorage struct {
+	root string
+}
+
+func (s *localStorage) path(bucket, key string) (string, error) {
+	if !fs.ValidPath(bucket) || strings.Contains(bucket, "/") || !fs.ValidPath(key) {
+		return "", fmt.Errorf("invalid object path: %s/%s", bucket, key)
+	}
+	return filepath.Join(s.root, bucket, filepath.FromSlash(key)), nil
+}
+
+func (s *localStorage) BucketExists(ctx context.Context, bucket string) (bool, error) {
+	path, err := s.path(bucket, ".")
+	if err != nil {
+		return false, err
+	}
+	st, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return st.IsDir(), nil
+}
+
+func (s *localStorage) List(ctx context.Context, bucket, prefix string) ([]ObjectInfo, error) {
+	dir, err := s.path(bucket, ".")
+	if err != nil {
+		return nil, err
+	}
+	result := make([]ObjectInfo, 0)
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || isUploadTemp(d.Name()) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := s.Stat(ctx, bucket, key)
+		if err != nil {
+			return err
+		}
+		result = append(result, info)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *localStorage) Stat(ctx context.Context, bucket, key string) (ObjectInfo, error) {
+	path, err := s.path(bucket, key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	st, err := os.Stat(path)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	if st.IsDir() {
+		return ObjectInfo{}, fmt.Errorf("not a file: %s", path)
+	}
+
+	// Hashing the content, like S3 does, would read gigabytes
+	// for every Stat and List. As ETag, we use file size and
+	// modification time, like the webserver does for its cache.
+	contentType := mime.TypeByExtension(filepath.Ext(path))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	info := ObjectInfo{
+		Key:         key,
+		ContentType: contentType,
+		ETag:        fmt.Sprintf("%x-%x", st.Size(), st.ModTime().UnixNano()),
+	}
+	return info, nil
+}
+
+func (s *localStorage) Get(ctx context.Context, bucket, key string) (io.Reader, error) {
+	path, err := s.path(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+func (s *localStorage) PutFile(ctx context.Context, bucket string, remotepath string, localpath string, contentType string) error {
+	path, err := s.path(bucket, remotepath)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	in, err := os.Open(localpath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	// Write to a temporary file, and then rename it to its final name.
+	// This makes the upload atomic, just like with S3.
+	out, err := os.CreateTemp(filepath.Dir(path), uploadTempPattern)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(out.Name())
+		return err
+	}
+	if err := os.Rename(out.Name(), path); err != nil {
+		os.Remove(out.Name())
+		return err
+	}
+	return nil
+}
+
+// UploadTempPattern is the name pattern of the temporary files
+// that PutFile writes before renaming them to their final name.
+const uploadTempPattern = ".upload-*.tmp"
+
+func isUploadTemp(name string) bool {
+	return strings.HasPrefix(name, ".upload-") && strings.HasSuffix(name, ".tmp")
+}
+
+func (s *localStorage) Remove(ctx context.Context, bucket, key string) error {
+	path, err := s.path(bucket, key)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// NewLocalStorage returns a Storage that keeps its objects in a local
+// directory, with one subdirectory per bucket. This allows to run the
+// pipeline on a laptop, or in a continuous integration job, without
+// setting up an S3-compatible server.
+func NewLocalStorage(root string) (Storage, error) {
+	st, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !st.IsDir() {
+		return nil, fmt.Errorf("not a directory: %s", root)
+	}
+	return &localStorage{root: root}, nil
+}
+
 // NewStorage sets up a client for accessing S3-compatible object storage.
+// If the S3_ENDPOINT environment variable is a file URL, such as
+// file:///var/lib/osmviews, the objects are kept on the local file system.
 func NewStorage() (Storage, error) {
 	endpoint := os.Getenv("S3_ENDPOINT")
+	if strings.HasPrefix(endpoint, "file:") {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		return NewLocalStorage(filepath.FromSlash(u.Path))
+	}
+
 	key := os.Getenv("S3_KEY")
 	secret := os.Getenv("S3_SECRET")
 	client, err := minio.New(endpoint, &minio.Options{
@@ -93,15 +275,38 @@ func NewStorage() (Storage, error) {
 	return &remoteStorage{client: client}, nil
 }
 
-func Cleanup(s Storage) error {
-	for _, p := range []struct {
-		prefix, pattern string
-		keep            int
-	}{
-		{"internal/osmviews-builder/tilelogs-", `internal/osmviews-builder/tilelogs-\d{4}-W\d{2}\.br`, 60},
-		{"public/osmviews-", `public/osmviews-\d{8}\.tiff`, 3},
-		{"public/osmviews-stats-", `public/osmviews-stats-\d{8}\.json`, 3},
-	} {
+// MaxTileLogWeeks is the number of weekly tile logs kept in storage.
+// This is enough for a 13-week trend against the same weeks one year
+// earlier.
+const maxTileLogWeeks = 65
+
+type cleanupPattern struct {
+	prefix, pattern string
+	keep            int
+}
+
+// Cleanup removes old files from storage. For each product, such as
+// "osmviews" or "osmviews-13w-mean", we keep the three most recent
+// versions of its GeoTIFF and statistics files. Of the seasonal files,
+// we keep the last four quarters and the last twelve months; their names
+// end in seasonSuffix, such as "-z14" for seasonal files at zoom 14.
+func Cleanup(s Storage, products []string, seasonSuffix string) error {
+	suffix := regexp.QuoteMeta(seasonSuffix)
+	patterns := make([]cleanupPattern, 0, 2*len(products)+5)
+	for _, product := range products {
+		quoted := regexp.QuoteMeta(product)
+		patterns = append(patterns,
+			cleanupPattern{"public/" + product + "-", `^public/` + quoted + `-\d{8}\.tiff$`, 3},
+			cleanupPattern{"public/" + product + "-stats-", `^public/` + quoted + `-stats-\d{8}\.json$`, 3})
+	}
+	patterns = append(patterns, []cleanupPattern{
+		{"internal/osmviews-builder/tilelogs-", `^internal/osmviews-builder/tilelogs-\d{4}-W\d{2}\.br$`, maxTileLogWeeks},
+		{"public/osmviews-", `^public/osmviews-\d{4}Q[1-4]` + suffix + `-\d{8}\.tiff$`, 4},
+		{"public/osmviews-", `^public/osmviews-\d{4}Q[1-4]` + suffix + `-stats-\d{8}\.json$`, 4},
+		{"public/osmviews-", `^public/osmviews-\d{4}-\d{2}` + suffix + `-\d{8}\.tiff$`, 12},
+		{"public/osmviews-", `^public/osmviews-\d{4}-\d{2}` + suffix + `-stats-\d{8}\.json$`, 12},
+	}...)
+	for _, p := range patterns {
 		if err := cleanupPath("osmviews", p.prefix, p.pattern, p.keep, s); err != nil {
 			return err
 		}
@@ -147,6 +352,9 @@ func Download(s Storage, bucket string, remotePath string, localPath string) err
 	}
 
 	r, err := s.Get(ctx, bucket, remotePath)
+	if c, ok := r.(io.Closer); ok && err == nil {
+		defer c.Close()
+	}
 	errMsg := fmt.Sprintf("download of s3://%s/%s failed", bucket, remotePath)
 	if err != nil {
 		out.Close()
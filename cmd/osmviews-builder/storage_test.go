@@ -29,6 +29,7 @@ func TestCleanup(t *testing.T) {
 	for _, path := range []string{
 		"internal/otherproject’s_data_should/not/be/touched.txt",
 		"public/osmviews-not-matching-pattern.txt",
+		"public/osmviews-13w-mean-20211205.tiff",
 		"public/quxfoo-20210830.csv.gz",
 	} {
 		if err := s.PutFile(ctx, "osmviews", path, localpath, "text/plain"); err != nil {
@@ -46,6 +47,17 @@ func TestCleanup(t *testing.T) {
 			}
 		}
 	}
+	for _, path := range []string{
+		"public/osmviews-2021Q1-20210404.tiff",
+		"public/osmviews-2021Q2-20210704.tiff",
+		"public/osmviews-2021Q3-20211003.tiff",
+		"public/osmviews-2021Q4-20220102.tiff",
+		"public/osmviews-2022Q1-20220403.tiff",
+	} {
+		if err := s.PutFile(ctx, "osmviews", path, localpath, "image/tiff"); err != nil {
+			t.Fatal(err)
+		}
+	}
 	for year := 2021; year <= 2022; year++ {
 		for week := 1; week <= 52; week++ {
 			if year == 2022 && week > 40 {
@@ -57,7 +69,7 @@ func TestCleanup(t *testing.T) {
 			}
 		}
 	}
-	if err := Cleanup(s); err != nil {
+	if err := Cleanup(s, []string{"osmviews"}, ""); err != nil {
 		t.Fatal(err)
 	}
 
@@ -72,6 +84,11 @@ func TestCleanup(t *testing.T) {
 	sort.Strings(got)
 
 	want := []string{
+		"internal/osmviews-builder/tilelogs-2021-W28.br",
+		"internal/osmviews-builder/tilelogs-2021-W29.br",
+		"internal/osmviews-builder/tilelogs-2021-W30.br",
+		"internal/osmviews-builder/tilelogs-2021-W31.br",
+		"internal/osmviews-builder/tilelogs-2021-W32.br",
 		"internal/osmviews-builder/tilelogs-2021-W33.br",
 		"internal/osmviews-builder/tilelogs-2021-W34.br",
 		"internal/osmviews-builder/tilelogs-2021-W35.br",
@@ -133,9 +150,14 @@ func TestCleanup(t *testing.T) {
 		"internal/osmviews-builder/tilelogs-2022-W39.br",
 		"internal/osmviews-builder/tilelogs-2022-W40.br",
 		"internal/otherproject’s_data_should/not/be/touched.txt",
+		"public/osmviews-13w-mean-20211205.tiff",
 		"public/osmviews-20211226.tiff",
+		"public/osmviews-2021Q2-20210704.tiff",
+		"public/osmviews-2021Q3-20211003.tiff",
+		"public/osmviews-2021Q4-20220102.tiff",
 		"public/osmviews-20220102.tiff",
 		"public/osmviews-20220109.tiff",
+		"public/osmviews-2022Q1-20220403.tiff",
 		"public/osmviews-not-matching-pattern.txt",
 		"public/osmviews-stats-20211226.json",
 		"public/osmviews-stats-20220102.json",
@@ -147,6 +169,53 @@ func TestCleanup(t *testing.T) {
 	}
 }
 
+// Seasonal files at other zoom levels than the default get cleaned up
+// separately, so they do not push out the files at the default zoom.
+func TestCleanup_SeasonSuffix(t *testing.T) {
+	ctx := context.Background()
+	localpath := filepath.Join(t.TempDir(), "testcleanup")
+	if err := os.WriteFile(localpath, []byte("foo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewFakeStorage()
+	for _, path := range []string{
+		"public/osmviews-2021Q1-20210404.tiff",
+		"public/osmviews-2021Q1-z14-20210404.tiff",
+		"public/osmviews-2021Q2-z14-20210704.tiff",
+		"public/osmviews-2021Q3-z14-20211003.tiff",
+		"public/osmviews-2021Q4-z14-20220102.tiff",
+		"public/osmviews-2022Q1-z14-20220403.tiff",
+	} {
+		if err := s.PutFile(ctx, "osmviews", path, localpath, "image/tiff"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Cleanup(s, nil, "-z14"); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := s.List(ctx, "osmviews", "public/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]string, 0, len(files))
+	for _, f := range files {
+		got = append(got, f.Key)
+	}
+	sort.Strings(got)
+	want := []string{
+		"public/osmviews-2021Q1-20210404.tiff",
+		"public/osmviews-2021Q2-z14-20210704.tiff",
+		"public/osmviews-2021Q3-z14-20211003.tiff",
+		"public/osmviews-2021Q4-z14-20220102.tiff",
+		"public/osmviews-2022Q1-z14-20220403.tiff",
+	}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
 func TestDownload(t *testing.T) {
 	remotePath := "remote/path.txt"
 	srcPath := filepath.Join(t.TempDir(), "test_download_src.txt")
@@ -176,6 +245,94 @@ func TestDownload(t *testing.T) {
 	}
 }
 
+func TestLocalStorage(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "osmviews"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewLocalStorage(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exists, err := s.BucketExists(ctx, "osmviews"); !exists || err != nil {
+		t.Errorf("BucketExists(\"osmviews\") = %v, %v; want true, nil", exists, err)
+	}
+	if exists, err := s.BucketExists(ctx, "other"); exists || err != nil {
+		t.Errorf("BucketExists(\"other\") = %v, %v; want false, nil", exists, err)
+	}
+
+	localpath := filepath.Join(t.TempDir(), "foo.txt")
+	if err := os.WriteFile(localpath, []byte("foo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{
+		"internal/osmviews-builder/tilelogs-2022-W01.br",
+		"public/osmviews-20220109.tiff",
+		"public/osmviews-20220102.tiff",
+		"public/notes.tmp",
+	} {
+		if err := s.PutFile(ctx, "osmviews", path, localpath, "text/plain"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := s.List(ctx, "osmviews", "public/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]string, 0, len(files))
+	for _, f := range files {
+		got = append(got, f.Key)
+	}
+	sort.Strings(got)
+	want := "public/notes.tmp|public/osmviews-20220102.tiff|public/osmviews-20220109.tiff"
+	if strings.Join(got, "|") != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Leftovers from interrupted uploads are not objects.
+	leftover := filepath.Join(root, "osmviews", "public", ".upload-123.tmp")
+	if err := os.WriteFile(leftover, []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if files, err := s.List(ctx, "osmviews", "public/"); err != nil || len(files) != 3 {
+		t.Errorf("got %v, %v; want 3 files", files, err)
+	}
+
+	info, err := s.Stat(ctx, "osmviews", "public/osmviews-20220109.tiff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(info.ETag, "3-") {
+		t.Errorf("got %+v, want ETag starting with size", info)
+	}
+
+	if _, err := s.Stat(ctx, "osmviews", "public/no-such-file.txt"); err == nil {
+		t.Error("Stat() should fail for missing files")
+	}
+	if _, err := s.Get(ctx, "osmviews", "../escaping/bucket.txt"); err == nil {
+		t.Error("Get() should fail for paths outside the bucket")
+	}
+
+	destPath := filepath.Join(t.TempDir(), "dest.txt")
+	if err := Download(s, "osmviews", "internal/osmviews-builder/tilelogs-2022-W01.br", destPath); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := os.ReadFile(destPath); err != nil || string(content) != "foo" {
+		t.Errorf("got %q, %v; want \"foo\"", content, err)
+	}
+
+	if err := s.Remove(ctx, "osmviews", "public/osmviews-20220102.tiff"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Stat(ctx, "osmviews", "public/osmviews-20220102.tiff"); err == nil {
+		t.Error("Stat() should fail after Remove()")
+	}
+}
+
 type FakeStorageObject struct {
 	Content []byte
 	Info    ObjectInfo
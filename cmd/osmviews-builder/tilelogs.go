@@ -25,17 +25,98 @@ import (
 	"golang.org/x/sync/errgroup"
 )
 
+// DefaultTileLogsURL is where OpenStreetMap publishes its tile logs.
+const DefaultTileLogsURL = "https://planet.openstreetmap.org/tile_logs/"
+
+// TileLogSource tells where to find the daily tile log files,
+// which are named like "tiles-2021-02-16.txt.xz".
+type TileLogSource struct {
+	// Locations are base URLs or local directories, in order
+	// of preference. If a location fails, the next one gets tried.
+	Locations []string
+
+	// Client is used for fetching files from base URLs.
+	Client *http.Client
+}
+
+// NewTileLogSource parses a comma-separated list of base URLs
+// and local directories into a TileLogSource.
+func NewTileLogSource(locations string, client *http.Client) (*TileLogSource, error) {
+	source := &TileLogSource{Client: client}
+	for _, loc := range strings.Split(locations, ",") {
+		loc = strings.TrimSpace(loc)
+		if loc == "" {
+			continue
+		}
+		if isURL(loc) && !strings.HasSuffix(loc, "/") {
+			loc += "/"
+		}
+		source.Locations = append(source.Locations, loc)
+	}
+	if len(source.Locations) == 0 {
+		return nil, fmt.Errorf("no tile log locations in %q", locations)
+	}
+	return source, nil
+}
+
+func isURL(location string) bool {
+	return strings.HasPrefix(location, "https://") || strings.HasPrefix(location, "http://")
+}
+
+// InLocalDir returns whether a file is in one of the local directories
+// of the source. Such directories may be the only copy of a historical
+// archive, so we must never remove their files, even if workdir is
+// the same directory.
+func (s *TileLogSource) inLocalDir(path string) bool {
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return true
+	}
+	for _, loc := range s.Locations {
+		if isURL(loc) {
+			continue
+		}
+		if locDir, err := filepath.Abs(loc); err != nil || locDir == dir {
+			return true
+		}
+	}
+	return false
+}
+
+var dailyTileLogsRegexp = regexp.MustCompile(`^tiles-(\d{4}-\d\d-\d\d)\.txt\.xz$`)
+
 // Return a list of weeks for which OpenStreetMap has tile logs.
 // Weeks are returned in ISO 8601 format such as "2021-W07".
 // The result is sorted from least to most recent week.
 // We return only those weeks where OpenStreetMap has tile logs
-// for all seven days.
-func GetAvailableWeeks(client *http.Client) ([]string, error) {
-	url := "https://planet.openstreetmap.org/tile_logs/"
+// for all seven days. The weeks are taken from the first location
+// of the source that can be listed.
+func GetAvailableWeeks(source *TileLogSource) ([]string, error) {
+	logger := log.Default()
+	var err error
+	for _, loc := range source.Locations {
+		var days []string
+		if isURL(loc) {
+			days, err = listTileLogsURL(source.Client, loc)
+		} else {
+			days, err = listTileLogsDir(loc)
+		}
+		if err == nil {
+			return availableWeeks(days), nil
+		}
+		logger.Printf("cannot list tile logs at %s: %v", loc, err)
+	}
+	return nil, err
+}
+
+// ListTileLogsURL returns the days whose tile logs are linked
+// from the HTML index page at url, formatted like "2021-02-16".
+func listTileLogsURL(client *http.Client, url string) ([]string, error) {
 	r, err := client.Get(url)
 	if err != nil {
 		return nil, err
 	}
+	defer r.Body.Close()
 
 	// Only accept HTTP responses with status code 200 OK
 	// and when the Content-Type header is HTML.
@@ -52,16 +133,43 @@ func GetAvailableWeeks(client *http.Client) ([]string, error) {
 		return nil, err
 	}
 
+	re := regexp.MustCompile(`<a href="tiles-(\d{4}-\d\d-\d\d)\.txt\.xz">`)
+	var days []string
+	for _, m := range re.FindAllSubmatch(body, -1) {
+		days = append(days, string(m[1]))
+	}
+	return days, nil
+}
+
+// ListTileLogsDir returns the days whose tile logs are stored
+// in a local directory, formatted like "2021-02-16".
+func listTileLogsDir(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var days []string
+	for _, e := range entries {
+		if m := dailyTileLogsRegexp.FindStringSubmatch(e.Name()); m != nil && !e.IsDir() {
+			days = append(days, m[1])
+		}
+	}
+	return days, nil
+}
+
+// AvailableWeeks returns the weeks for which all seven days are
+// in a list of days, formatted like "2021-02-16".
+func availableWeeks(days []string) []string {
 	// Find out what weeks are available. For each week, we keep a bitmask
 	// that tells for which days of that week the OSM Planet server
 	// has log files available. For example, if this map contains
 	// the entry 202107 → 5 (in binary: 0000101), the server has log files
 	// for Tuesday (0000100) and Sunday (0000001) for the 7th week of 2021.
 	// That is, Tuesday, February 16, and Sunday, February 21.
-	re := regexp.MustCompile(`<a href="tiles-(\d{4}-\d\d-\d\d)\.txt\.xz">`)
 	available := make(map[int]int8) // (year*100+isoweek) → 7 bits
-	for _, m := range re.FindAllSubmatch(body, -1) {
-		if t, err := time.Parse("2006-01-02", string(m[1])); err == nil {
+	for _, day := range days {
+		if t, err := time.Parse("2006-01-02", day); err == nil {
 			year, week := t.ISOWeek()
 			available[year*100+week] |= 1 << int8(t.Weekday())
 		}
@@ -76,7 +184,7 @@ func GetAvailableWeeks(client *http.Client) ([]string, error) {
 		}
 	}
 	sort.Strings(result)
-	return result, nil
+	return result
 }
 
 var tileLogRegexp = regexp.MustCompile(`^(\d+)/(\d+)/(\d+)\s+(\d+)$`)
@@ -84,10 +192,9 @@ var tileLogRegexp = regexp.MustCompile(`^(\d+)/(\d+)/(\d+)\s+(\d+)$`)
 // GetTileLogs returns an io.Reader for the sorted log records of a week.
 // If cachedir contains already contains cached records for the requested week,
 // the data will be read from local disk. Otherwise, the seven daily log files
-// for the requested week are fetched from the OpenStreetMap planet server,
-// uncompressed, sorted by TileKey, and stored as a compressed file into
-// cachedir.
-func GetTileLogs(week string, client *http.Client, workdir string, storage Storage) (io.Reader, error) {
+// for the requested week are fetched from the source, uncompressed,
+// sorted by TileKey, and stored as a compressed file into cachedir.
+func GetTileLogs(week string, source *TileLogSource, workdir string, storage Storage) (io.Reader, error) {
 	ctx := context.Background()
 	logger := log.Default()
 
@@ -127,8 +234,11 @@ func GetTileLogs(week string, client *http.Client, workdir string, storage Stora
 	config := extsort.DefaultConfig()
 	config.NumWorkers = runtime.NumCPU()
 	sorter, outChan, errChan := extsort.New(ch, TileCountFromBytes, TileCountLess, config)
+	var fetched []string
 	g.Go(func() error {
-		return fetchWeeklyTileLogs(week, client, ch, subCtx)
+		var err error
+		fetched, err = fetchWeeklyTileLogs(week, source, workdir, ch, subCtx)
+		return err
 	})
 	g.Go(func() error {
 		sorter.Sort(ctx) // not subCtx, as per extsort docs
@@ -190,6 +300,11 @@ func GetTileLogs(week string, client *http.Client, workdir string, storage Stora
 		return nil, err
 	}
 
+	// The daily log files that we have fetched are not needed anymore.
+	if err := removeDailyTileLogs(fetched); err != nil {
+		return nil, err
+	}
+
 	// Upload the file to object storage.
 	contentType := "application/x-brotli"
 	if err := storage.PutFile(ctx, "osmviews", remotePath, path, contentType); err != nil {
@@ -205,38 +320,104 @@ func GetTileLogs(week string, client *http.Client, workdir string, storage Stora
 	}
 }
 
-func fetchWeeklyTileLogs(week string, client *http.Client, ch chan<- extsort.SortType, ctx context.Context) error {
+// FetchWeeklyTileLogs sends the tile counts of a week to a channel,
+// and returns the paths of the daily log files it has fetched into
+// workdir.
+func fetchWeeklyTileLogs(week string, source *TileLogSource, workdir string, ch chan<- extsort.SortType, ctx context.Context) ([]string, error) {
 	defer close(ch)
 
 	// Fetch the tile logs for the seven days in this week, in parallel.
 	parsedYear, parsedWeek, err := ParseWeek(week)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Initially we did the fetches in parallel, but planet.openstreetmap.org
 	// only seems to accept 1-2 connections from the same IP address.
 	firstDay := weekStart(parsedYear, parsedWeek)
+	fetched := make([]string, 0, 7)
 	for i := 0; i < 7; i++ {
 		day := firstDay.AddDate(0, 0, i)
-		if err := fetchTileLogs(day, client, ch, ctx); err != nil {
-			return err
+		path, err := fetchTileLogs(day, source, workdir, ch, ctx)
+		if err != nil {
+			return nil, err
+		}
+		if path != "" {
+			fetched = append(fetched, path)
 		}
 	}
 
-	return nil
+	return fetched, nil
 }
 
-func fetchTileLogs(day time.Time, client *http.Client, ch chan<- extsort.SortType, ctx context.Context) error {
-	url := fmt.Sprintf(
-		"https://planet.openstreetmap.org/tile_logs/tiles-%04d-%02d-%02d.txt.xz",
-		day.Year(), day.Month(), day.Day())
-	r, err := client.Get(url)
+// FetchTileLogs sends the tile counts of one day to a channel.
+// Files fetched from the web get cached in workdir, so that they do
+// not need to be fetched again if processing the week fails later on.
+// The result is the path of the cached file, or empty if the file
+// has been used in place.
+func fetchTileLogs(day time.Time, source *TileLogSource, workdir string, ch chan<- extsort.SortType, ctx context.Context) (string, error) {
+	path, cached, err := findTileLogs(day, source, workdir, ctx)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	reader, err := xz.NewReader(r.Body)
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	// If the cached file is corrupt, remove it from the cache
+	// so that the next run fetches it again.
+	if err := parseTileLogs(f, ch, ctx); err != nil {
+		if cached && ctx.Err() == nil {
+			os.Remove(path)
+		}
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	if !cached {
+		return "", nil
+	}
+	return path, nil
+}
+
+// FindTileLogs returns the path to the log file for a day, trying the
+// locations of the source in order. Files in local directories are
+// used in place. Files on the web get fetched into workdir, in which
+// case cached is true. If workdir is also one of the source’s local
+// directories, files that were there before are not ours, so they
+// count as used in place.
+func findTileLogs(day time.Time, source *TileLogSource, workdir string, ctx context.Context) (path string, cached bool, err error) {
+	logger := log.Default()
+	filename := dailyTileLogsFilename(day)
+	for _, loc := range source.Locations {
+		if !isURL(loc) {
+			path = filepath.Join(loc, filename)
+			if _, err = os.Stat(path); err == nil {
+				return path, false, nil
+			}
+		} else {
+			path = filepath.Join(workdir, filename)
+			_, statErr := os.Stat(path)
+			existed := statErr == nil
+			if err = downloadURL(ctx, source.Client, loc+filename, path); err == nil {
+				return path, !existed || !source.inLocalDir(path), nil
+			}
+
+			// Mirrors may differ in their compression settings,
+			// so the next location must start from scratch.
+			os.Remove(path + ".part")
+		}
+		if ctx.Err() != nil {
+			return "", false, ctx.Err()
+		}
+		logger.Printf("cannot get %s from %s: %v", filename, loc, err)
+	}
+	return "", false, err
+}
+
+func parseTileLogs(r io.Reader, ch chan<- extsort.SortType, ctx context.Context) error {
+	reader, err := xz.NewReader(r)
 	if err != nil {
 		return err
 	}
@@ -262,6 +443,22 @@ func fetchTileLogs(day time.Time, client *http.Client, ch chan<- extsort.SortTyp
 	return nil
 }
 
+func dailyTileLogsFilename(day time.Time) string {
+	return fmt.Sprintf("tiles-%04d-%02d-%02d.txt.xz", day.Year(), day.Month(), day.Day())
+}
+
+// RemoveDailyTileLogs removes daily log files that have been fetched
+// into workdir. Files in local directories of the tile log source
+// never get passed here, because they were not ours to begin with.
+func removeDailyTileLogs(paths []string) error {
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
 // Reverse of Go’s time.ISOWeek() function.
 func weekStart(year, week int) time.Time {
 	// Find the first Monday before July 1 of the given year.
@@ -14,6 +14,9 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/lanrat/extsort"
 )
 
 // A fake HTTP transport that answers the same requests as planet.osm.org.
@@ -47,17 +50,44 @@ func (f *FakeOSMPlanet) RoundTrip(req *http.Request) (*http.Response, error) {
 		if err != nil {
 			return nil, err
 		}
+		stat, err := body.Stat()
+		if err != nil {
+			return nil, err
+		}
 
 		header.Add("Content-Type", "application/x-xz")
-		return &http.Response{StatusCode: 200, Body: body, Header: header}, nil
+		return &http.Response{StatusCode: 200, Body: body, Header: header, ContentLength: stat.Size()}, nil
 	}
 
 	return nil, fmt.Errorf("unexpected request: %s", url)
 }
 
+func newFakeTileLogSource(broken bool, locations ...string) *TileLogSource {
+	client := &http.Client{Transport: &FakeOSMPlanet{Broken: broken}}
+	if len(locations) == 0 {
+		locations = []string{DefaultTileLogsURL}
+	}
+	return &TileLogSource{Locations: locations, Client: client}
+}
+
+func TestNewTileLogSource(t *testing.T) {
+	source, err := NewTileLogSource("https://a.example.org/logs, /srv/tile_logs,http://b.example.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := fmt.Sprintf("%q", source.Locations)
+	want := `["https://a.example.org/logs/" "/srv/tile_logs" "http://b.example.org/"]`
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	if _, err := NewTileLogSource(" , ", nil); err == nil {
+		t.Error("want error for empty list of locations")
+	}
+}
+
 func TestGetAvailableWeeks(t *testing.T) {
-	client := &http.Client{Transport: &FakeOSMPlanet{}}
-	weeks, err := GetAvailableWeeks(client)
+	weeks, err := GetAvailableWeeks(newFakeTileLogSource(false))
 	if err != nil {
 		t.Error(err)
 		return
@@ -70,22 +100,56 @@ func TestGetAvailableWeeks(t *testing.T) {
 }
 
 func TestGetAvailableWeeksServerError(t *testing.T) {
-	client := &http.Client{Transport: &FakeOSMPlanet{Broken: true}}
-	_, err := GetAvailableWeeks(client)
+	_, err := GetAvailableWeeks(newFakeTileLogSource(true))
 	if !strings.HasPrefix(err.Error(), "failed to fetch") {
 		t.Errorf("expected fetch failure, got %v", err)
 	}
 }
 
+func TestGetAvailableWeeksFallback(t *testing.T) {
+	source := newFakeTileLogSource(false, "https://mirror.example.org/tile_logs/", DefaultTileLogsURL)
+	weeks, err := GetAvailableWeeks(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprintf("%s", weeks); got != "[2021-W52 2022-W01]" {
+		t.Errorf("expected [2021-W52 2022-W01], got %s", got)
+	}
+}
+
+func TestGetAvailableWeeksDir(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"tiles-2022-01-02.txt.xz", // Sunday of 2021-W52
+		"tiles-2022-01-03.txt.xz", "tiles-2022-01-04.txt.xz",
+		"tiles-2022-01-05.txt.xz", "tiles-2022-01-06.txt.xz",
+		"tiles-2022-01-07.txt.xz", "tiles-2022-01-08.txt.xz",
+		"tiles-2022-01-09.txt.xz", // Sunday of 2022-W01
+		"tiles-2022-01-10.txt.xz.part",
+		"README",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	weeks, err := GetAvailableWeeks(&TileLogSource{Locations: []string{dir}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprintf("%s", weeks); got != "[2022-W01]" {
+		t.Errorf("expected [2022-W01], got %s", got)
+	}
+}
+
 func TestGetTileLogs(t *testing.T) {
-	client := &http.Client{Transport: &FakeOSMPlanet{}}
 	workdir, err := ioutil.TempDir("", "tilelogs_test")
 	if err != nil {
 		t.Error(err)
 		return
 	}
 	s := NewFakeStorage()
-	reader, err := GetTileLogs("2567-W12", client, workdir, s)
+	reader, err := GetTileLogs("2567-W12", newFakeTileLogSource(false), workdir, s)
 	if err != nil {
 		t.Error(err)
 		return
@@ -203,6 +267,33 @@ func TestGetTileLogs(t *testing.T) {
 	if want := "application/x-brotli"; stat.ContentType != want {
 		t.Errorf(`got "%s", want "%s"`, stat.ContentType, want)
 	}
+
+	// The daily log files should have been removed from workdir.
+	daily, err := filepath.Glob(filepath.Join(workdir, "tiles-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(daily) != 0 {
+		t.Errorf("got %v, want no daily log files in workdir", daily)
+	}
+}
+
+func TestFetchTileLogs_CorruptCache(t *testing.T) {
+	workdir := t.TempDir()
+	day := time.Date(2567, 3, 20, 0, 0, 0, 0, time.UTC)
+	path := filepath.Join(workdir, "tiles-2567-03-20.txt.xz")
+	if err := os.WriteFile(path, []byte("corrupt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ch := make(chan extsort.SortType, 1000)
+	_, err := fetchTileLogs(day, newFakeTileLogSource(true), workdir, ch, context.Background())
+	if err == nil {
+		t.Error("want error for corrupt cached file")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("corrupt cached file should have been removed")
+	}
 }
 
 func TestGetTileLogsCachedInStorage(t *testing.T) {
@@ -283,3 +374,69 @@ func TestWeekStart(t *testing.T) {
 func ExampleParseWeek() {
 	fmt.Println(ParseWeek("2018-W51")) // Output: 2018 51 <nil>
 }
+
+func TestGetTileLogsFallback(t *testing.T) {
+	setDownloadTimeouts(t, time.Millisecond, time.Minute)
+
+	// The first location is a local directory that has the logs for
+	// only one day of the week, the second is a broken mirror.
+	dir := t.TempDir()
+	data, err := os.ReadFile("testdata/rapperswil.xz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "tiles-2567-03-20.txt.xz"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	source := newFakeTileLogSource(false, dir, "https://mirror.example.org/", DefaultTileLogsURL)
+
+	workdir := t.TempDir()
+	reader, err := GetTileLogs("2567-W12", source, workdir, NewFakeStorage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := readStream(reader)
+	if want := "14/8593/5747 1421\n"; !strings.HasPrefix(got, want) {
+		t.Errorf("got %q, want prefix %q", got[:min(len(got), 40)], want)
+	}
+
+	// The file in the local directory must not have been removed.
+	if _, err := os.Stat(filepath.Join(dir, "tiles-2567-03-20.txt.xz")); err != nil {
+		t.Error(err)
+	}
+}
+
+// If workdir is also a local directory with archived tile logs,
+// only the files that the builder has fetched may get removed.
+func TestGetTileLogs_WorkdirIsArchive(t *testing.T) {
+	workdir := t.TempDir()
+	data, err := os.ReadFile("testdata/rapperswil.xz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	archived := []string{"tiles-2567-03-20.txt.xz", "tiles-2567-03-22.txt.xz"}
+	for _, name := range archived {
+		if err := os.WriteFile(filepath.Join(workdir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The web comes first, so even the archived files get looked up
+	// in workdir as if they had been fetched by an earlier run.
+	source := newFakeTileLogSource(false, DefaultTileLogsURL, workdir)
+	if _, err := GetTileLogs("2567-W12", source, workdir, NewFakeStorage()); err != nil {
+		t.Fatal(err)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(workdir, "tiles-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, path := range paths {
+		got = append(got, filepath.Base(path))
+	}
+	if got, want := strings.Join(got, "|"), strings.Join(archived, "|"); got != want {
+		t.Errorf("got %q in workdir, want %q", got, want)
+	}
+}
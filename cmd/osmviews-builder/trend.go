@@ -0,0 +1,129 @@
+// SPDX-FileCopyrightText: 2026 Sascha Brawer <sascha@brawer.ch>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// TrendWriter produces a GeoTIFF that compares two windows of weeks,
+// such as the last 13 weeks against the same 13 weeks one year earlier.
+// Each window gets painted by its own Painter. Because both painters
+// receive the same sequence of tiles, their raster trees evolve in
+// lockstep, and they emit rasters for the same tiles in the same order.
+// As soon as the rasters for a tile have arrived from both sides,
+// TrendWriter stores ln(1 + recent) - ln(1 + baseline) into a signed
+// output, so we never need to keep more than a few rasters in memory.
+type trendWriter struct {
+	out     *RasterWriter
+	pending [2][]trendRaster
+	closed  int
+}
+
+// TrendRaster is a raster that has been received from one side,
+// but not yet from the other.
+type trendRaster struct {
+	tile    TileKey
+	pixels  *[256 * 256]float32 // nil for uniform rasters
+	uniform float32
+}
+
+const (
+	trendRecent   = 0
+	trendBaseline = 1
+)
+
+func newTrendWriter(path string, zoom uint8) (*trendWriter, error) {
+	desc := "Change in OpenStreetMap view density, as ln(1 + recent) - ln(1 + baseline) of weekly user views per km2"
+	out, err := NewSignedRasterWriter(path, zoom, desc)
+	if err != nil {
+		return nil, err
+	}
+	return &trendWriter{out: out}, nil
+}
+
+// Side returns the rasterSink for the recent or baseline painter.
+func (w *trendWriter) side(side int) rasterSink {
+	return &trendSide{writer: w, side: side}
+}
+
+func (w *trendWriter) add(side int, r trendRaster) error {
+	w.pending[side] = append(w.pending[side], r)
+	for len(w.pending[trendRecent]) > 0 && len(w.pending[trendBaseline]) > 0 {
+		recent, baseline := w.pending[trendRecent][0], w.pending[trendBaseline][0]
+		w.pending[trendRecent] = w.pending[trendRecent][1:]
+		w.pending[trendBaseline] = w.pending[trendBaseline][1:]
+		if recent.tile != baseline.tile {
+			return fmt.Errorf("trend painters out of step: recent %s, baseline %s", recent.tile, baseline.tile)
+		}
+		if err := w.write(recent, baseline); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *trendWriter) write(recent, baseline trendRaster) error {
+	if recent.pixels == nil && baseline.pixels == nil {
+		val := logRatio(recent.uniform, baseline.uniform)
+		return w.out.WriteSignedUniform(recent.tile, val)
+	}
+
+	var pixels [256 * 256]float32
+	for i := range pixels {
+		a, b := recent.uniform, baseline.uniform
+		if recent.pixels != nil {
+			a = recent.pixels[i]
+		}
+		if baseline.pixels != nil {
+			b = baseline.pixels[i]
+		}
+		pixels[i] = logRatio(a, b)
+	}
+	return w.out.WriteSigned(recent.tile, pixels[:])
+}
+
+func (w *trendWriter) close() error {
+	w.closed += 1
+	if w.closed < 2 {
+		return nil
+	}
+	if len(w.pending[trendRecent]) != 0 || len(w.pending[trendBaseline]) != 0 {
+		return fmt.Errorf("trend painters out of step: %d recent and %d baseline rasters left",
+			len(w.pending[trendRecent]), len(w.pending[trendBaseline]))
+	}
+	return w.out.Close()
+}
+
+// LogRatio returns ln(1 + recent) - ln(1 + baseline). Positive values
+// mean that a place has been gaining attention, negative values that
+// it has been losing attention.
+func logRatio(recent, baseline float32) float32 {
+	return float32(math.Log1p(float64(recent)) - math.Log1p(float64(baseline)))
+}
+
+type trendSide struct {
+	writer *trendWriter
+	side   int
+}
+
+func (s *trendSide) Write(r *Raster) error {
+	return s.writer.add(s.side, trendRaster{tile: r.tile, pixels: &r.pixels})
+}
+
+// WriteUniformDensity keeps the exact density, since rounding it would
+// give a trend of 0 for sparse areas, or spurious trends for densities
+// on both sides of a rounding boundary.
+func (s *trendSide) WriteUniformDensity(tile TileKey, viewsPerKm2 float32) error {
+	return s.writer.add(s.side, trendRaster{tile: tile, uniform: viewsPerKm2})
+}
+
+func (s *trendSide) Close() error {
+	return s.writer.close()
+}
+
+func (s *trendSide) abort() {
+	s.writer.out.abort()
+}
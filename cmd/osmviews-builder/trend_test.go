@@ -0,0 +1,120 @@
+// SPDX-FileCopyrightText: 2026 Sascha Brawer <sascha@brawer.ch>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/brawer/osmviews/v2/geotiff"
+)
+
+func TestPaintJobs_Trend(t *testing.T) {
+	readers := []io.Reader{
+		strings.NewReader("11/1000/700 100\n11/1001/700 300\n"),
+		strings.NewReader("11/1000/700 400\n11/1002/700 50\n"),
+	}
+	weeks := []string{"2022-W01", "2023-W01"}
+	path := filepath.Join(t.TempDir(), "trend.tif")
+	job := PaintJob{
+		Path:              path,
+		FirstWeek:         1,
+		LimitWeek:         2,
+		BaselineFirstWeek: 0,
+		BaselineLimitWeek: 1,
+		Statistic:         Median,
+	}
+	if err := paintJobs([]PaintJob{job}, 11, readers, weeks, context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := geotiff.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img := r.Images[0]
+	data := make([]float32, 256*256)
+	if err := img.ReadTile(2*img.TilesAcross()+3, data); err != nil {
+		t.Fatal(err)
+	}
+	area := float64(TileArea(11, 700))
+	for _, tc := range []struct {
+		x                int
+		recent, baseline float64
+	}{
+		{1000, 400, 100}, // gaining attention
+		{1001, 0, 300},   // losing attention
+		{1002, 50, 0},    // new
+		{1003, 0, 0},     // unchanged
+	} {
+		got := data[(700-512)*256+tc.x-768]
+		want := math.Log1p(tc.recent/area) - math.Log1p(tc.baseline/area)
+		if math.Abs(float64(got)-want) > 1e-5 {
+			t.Errorf("pixel %d: got %f, want %f", tc.x, got, want)
+		}
+	}
+
+	if img.MaxValue <= 0 {
+		t.Errorf("got MaxValue=%f, want positive", img.MaxValue)
+	}
+}
+
+// In sparse areas, uniform rasters must compare the exact densities,
+// not the densities rounded to whole views per km².
+func TestPaintJobs_TrendUniform(t *testing.T) {
+	readers := []io.Reader{
+		strings.NewReader("2/2/1 10000000\n"),
+		strings.NewReader("2/2/1 30000000\n"),
+	}
+	weeks := []string{"2022-W01", "2023-W01"}
+	path := filepath.Join(t.TempDir(), "trend.tif")
+	job := PaintJob{
+		Path:              path,
+		FirstWeek:         1,
+		LimitWeek:         2,
+		BaselineFirstWeek: 0,
+		BaselineLimitWeek: 1,
+		Statistic:         Median,
+	}
+	if err := paintJobs([]PaintJob{job}, 11, readers, weeks, context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := geotiff.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Tile 3/4/2 lies within 2/2/1, but has not been painted itself.
+	area := float64(TileArea(2, 1))
+	recent, baseline := 3e7/area, 1e7/area
+	if recent >= 1 || baseline >= 1 {
+		t.Fatalf("test needs densities below 1, got %f and %f", recent, baseline)
+	}
+	img := r.Images[0]
+	data := make([]float32, 256*256)
+	if err := img.ReadTile(2*img.TilesAcross()+4, data); err != nil {
+		t.Fatal(err)
+	}
+	want := math.Log1p(recent) - math.Log1p(baseline)
+	if got := data[0]; math.Abs(float64(got)-want) > 1e-5 {
+		t.Errorf("got %f, want %f", got, want)
+	}
+}
@@ -0,0 +1,174 @@
+// SPDX-FileCopyrightText: 2026 Sascha Brawer <sascha@brawer.ch>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/brawer/osmviews/v2/geotiff"
+)
+
+// ValidateCOG checks that a GeoTIFF file produced by RasterWriter
+// is a valid Cloud-Optimized GeoTIFF, so that a bug in the writer
+// makes the weekly job fail instead of publishing a corrupt file.
+// https://gdal.org/drivers/raster/cog.html
+func ValidateCOG(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := validateCOG(f); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func validateCOG(f *os.File) error {
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	fileSize := stat.Size()
+
+	r, err := geotiff.NewReader(f)
+	if err != nil {
+		return err
+	}
+
+	headerSize := int64(8)
+	if r.BigTIFF {
+		headerSize = 16
+	}
+	if err := validateGhostArea(f, headerSize); err != nil {
+		return err
+	}
+
+	// Each overview must be half the size of the previous image,
+	// down to a single tile for the entire world.
+	for i, img := range r.Images {
+		if i > 0 {
+			prev := r.Images[i-1]
+			if img.Width != prev.Width/2 || img.Height != prev.Height/2 {
+				return fmt.Errorf("image %d is %dx%d, want %dx%d", i, img.Width, img.Height, prev.Width/2, prev.Height/2)
+			}
+		}
+	}
+	if last := r.Images[len(r.Images)-1]; len(last.TileOffsets) != 1 {
+		return fmt.Errorf("coarsest overview has %d tiles, want 1", len(last.TileOffsets))
+	}
+
+	// Check the leader and trailer around every tile. Since many tiles
+	// share the same data, each distinct tile needs to be checked once.
+	checked := make(map[uint64]bool, 1024)
+	minTileOffset := fileSize
+	for i, img := range r.Images {
+		for tile, offset := range img.TileOffsets {
+			size := img.TileByteCounts[tile]
+			if checked[offset] {
+				continue
+			}
+			checked[offset] = true
+			if offset < uint64(headerSize)+4 || offset+uint64(size)+4 > uint64(fileSize) || size < 4 {
+				return fmt.Errorf("image %d, tile %d: %d bytes at offset %d outside file of %d bytes", i, tile, size, offset, fileSize)
+			}
+			minTileOffset = min(minTileOffset, int64(offset))
+			if err := validateLeaderTrailer(f, int64(offset), size); err != nil {
+				return fmt.Errorf("image %d, tile %d: %w", i, tile, err)
+			}
+		}
+	}
+
+	// With LAYOUT=IFDS_BEFORE_DATA, clients can fetch all image file
+	// directories with a single request for the start of the file.
+	for i, img := range r.Images {
+		if img.Offset >= minTileOffset {
+			return fmt.Errorf("image file directory %d at offset %d comes after tile data at offset %d", i, img.Offset, minTileOffset)
+		}
+	}
+
+	// Decode a sample of the tiles of each image. The first and last
+	// tiles are always part of the sample.
+	const maxSamples = 64
+	for i, img := range r.Images {
+		data := make([]float32, img.TileWidth*img.TileHeight*img.SamplesPerPixel)
+		numTiles := len(img.TileOffsets)
+		for s := 0; s < min(numTiles, maxSamples); s++ {
+			tile := s * (numTiles - 1) / max(min(numTiles, maxSamples)-1, 1)
+			if err := img.ReadTile(tile, data); err != nil {
+				return fmt.Errorf("image %d, tile %d: %w", i, tile, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ValidateGhostArea checks the structural metadata that GDAL expects
+// right after the TIFF header.
+// https://gdal.org/drivers/raster/cog.html#header-ghost-area
+func validateGhostArea(f *os.File, headerSize int64) error {
+	const prefix = "GDAL_STRUCTURAL_METADATA_SIZE="
+	head := make([]byte, len(prefix)+len("000000 bytes\n"))
+	if _, err := f.ReadAt(head, headerSize); err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(head, []byte(prefix)) || !bytes.HasSuffix(head, []byte(" bytes\n")) {
+		return fmt.Errorf("missing GDAL structural metadata")
+	}
+	size, err := strconv.Atoi(string(head[len(prefix) : len(prefix)+6]))
+	if err != nil {
+		return fmt.Errorf("bad GDAL structural metadata size: %w", err)
+	}
+
+	buf := make([]byte, size)
+	if _, err := f.ReadAt(buf, headerSize+int64(len(head))); err != nil {
+		return err
+	}
+	metadata := strings.Split(string(buf), "\n")
+	for _, want := range []string{
+		"LAYOUT=IFDS_BEFORE_DATA",
+		"BLOCK_LEADER=SIZE_AS_UINT4",
+		"BLOCK_TRAILER=LAST_4_BYTES_REPEATED",
+	} {
+		found := false
+		for _, line := range metadata {
+			if line == want {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("GDAL structural metadata lacks %s", want)
+		}
+	}
+	return nil
+}
+
+// ValidateLeaderTrailer checks the four bytes before a tile, which
+// must hold its size, and the four bytes after it, which must repeat
+// its last four bytes.
+func validateLeaderTrailer(f *os.File, offset int64, size uint32) error {
+	var leader [4]byte
+	if _, err := f.ReadAt(leader[:], offset-4); err != nil {
+		return err
+	}
+	if got := binary.LittleEndian.Uint32(leader[:]); got != size {
+		return fmt.Errorf("leader says %d bytes, want %d", got, size)
+	}
+
+	var end [8]byte
+	if _, err := f.ReadAt(end[:], offset+int64(size)-4); err != nil {
+		return err
+	}
+	if !bytes.Equal(end[:4], end[4:]) {
+		return fmt.Errorf("trailer %v does not repeat last bytes %v", end[4:], end[:4])
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+// SPDX-FileCopyrightText: 2026 Sascha Brawer <sascha@brawer.ch>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/brawer/osmviews/v2/geotiff"
+)
+
+func paintValidationTestFiles(t *testing.T) []PaintJob {
+	file, err := os.Open(filepath.Join("testdata", "zurich-2021-W47.br"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	readers := []io.Reader{brotli.NewReader(file)}
+	dir := t.TempDir()
+	jobs := []PaintJob{
+		{Path: filepath.Join(dir, "plain.tif"), FirstWeek: 0, LimitWeek: 1, Statistic: Median},
+		{Path: filepath.Join(dir, "aux.tif"), FirstWeek: 0, LimitWeek: 1, Statistic: Median, AuxBands: true},
+		{Path: filepath.Join(dir, "bigtiff.tif"), FirstWeek: 0, LimitWeek: 1, Statistic: Median, BigTIFF: true, Compression: Zstd},
+	}
+	if err := paintJobs(jobs, 11, readers, []string{"2021-W47"}, context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return jobs
+}
+
+func TestValidateCOG(t *testing.T) {
+	for _, job := range paintValidationTestFiles(t) {
+		if err := ValidateCOG(job.Path); err != nil {
+			t.Errorf("%s: %v", filepath.Base(job.Path), err)
+		}
+	}
+}
+
+func TestValidateCOG_Corrupt(t *testing.T) {
+	path := paintValidationTestFiles(t)[0].Path
+	original, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := geotiff.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tileOffset := r.Images[0].TileOffsets[0]
+	tileSize := r.Images[0].TileByteCounts[0]
+
+	for _, tc := range []struct {
+		pos  uint64
+		want string
+	}{
+		{10, "missing GDAL structural metadata"},
+		{tileOffset - 4, "leader says"},
+		{tileOffset + uint64(tileSize), "does not repeat last bytes"},
+	} {
+		corrupt := filepath.Join(t.TempDir(), "corrupt.tif")
+		data := append([]byte(nil), original...)
+		data[tc.pos] ^= 0xff
+		if err := os.WriteFile(corrupt, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		err := ValidateCOG(corrupt)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("corrupt byte at %d: got %v, want error with %q", tc.pos, err, tc.want)
+		}
+	}
+}
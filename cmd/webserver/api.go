@@ -0,0 +1,401 @@
+// SPDX-FileCopyrightText: 2026 Sascha Brawer <sascha@brawer.ch>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/brawer/osmviews/v2/geotiff"
+)
+
+// RankResponse is the JSON body returned by the /api/v1/rank endpoint.
+type rankResponse struct {
+	Lat   float64 `json:"lat"`
+	Lng   float64 `json:"lng"`
+	Value float64 `json:"value"` // weekly views per km²
+	Zoom  uint8   `json:"zoom"`  // zoom level of the pixel
+	Tile  string  `json:"tile"`  // the pixel, as zoom/x/y web mercator tile
+	Date  string  `json:"date"`  // date of the GeoTIFF, such as "2021-12-29"
+}
+
+// HandleRank looks up the value of a single geographic location
+// in the currently published GeoTIFF file.
+//
+// Example: /api/v1/rank?lat=47.391485&lng=8.488945
+//
+// By default, the value is taken from the most detailed image.
+// With an optional zoom parameter, such as &zoom=12, the value
+// is taken from the most detailed overview whose pixels are
+// not smaller than web mercator tiles at the requested zoom level.
+func (ws *Webserver) HandleRank(w http.ResponseWriter, req *http.Request) {
+	h := w.Header()
+	h.Set("Server", ServerVersion)
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		h.Set("Access-Control-Allow-Origin", "*")
+
+	case http.MethodOptions: // CORS pre-flight
+		h.Set("Allow", "GET, HEAD, OPTIONS")
+		h.Set("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+		h.Set("Access-Control-Allow-Origin", "*")
+		h.Set("Access-Control-Max-Age", "86400") // 1 day
+		w.WriteHeader(http.StatusNoContent)
+		return
+
+	default:
+		h.Set("Allow", "GET, HEAD, OPTIONS")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// ParseFloat accepts "NaN", which would pass the range checks.
+	query := req.URL.Query()
+	lat, err := strconv.ParseFloat(query.Get("lat"), 64)
+	if err != nil || math.IsNaN(lat) || lat < -geotiff.MaxLatitude || lat > geotiff.MaxLatitude {
+		http.Error(w, "bad or missing parameter: lat", http.StatusBadRequest)
+		return
+	}
+
+	lng, err := strconv.ParseFloat(query.Get("lng"), 64)
+	if err != nil || math.IsNaN(lng) || lng < -180 || lng > 180 {
+		http.Error(w, "bad or missing parameter: lng", http.StatusBadRequest)
+		return
+	}
+
+	zoom := 255
+	if z := query.Get("zoom"); z != "" {
+		zoom, err = strconv.Atoi(z)
+		if err != nil || zoom < 0 {
+			http.Error(w, "bad parameter: zoom", http.StatusBadRequest)
+			return
+		}
+	}
+
+	g, err := ws.storage.RetrieveGeoTiff("osmviews.tiff")
+	if err != nil {
+		http.NotFound(w, req)
+		return
+	}
+
+	img := g.ImageAt(zoom)
+	x, y := img.PixelAt(lat, lng)
+	val, err := img.ReadPixel(x, y, 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := rankResponse{
+		Lat:   lat,
+		Lng:   lng,
+		Value: math.Expm1(float64(val)),
+		Zoom:  img.Zoom(),
+		Tile:  fmt.Sprintf("%d/%d/%d", img.Zoom(), x, y),
+		Date:  g.Date.Format("2006-01-02"),
+	}
+	body, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.Set("Content-Type", "application/json")
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+	if req.Method == http.MethodGet {
+		w.Write(body)
+	}
+}
+
+// MaxEnrichBodySize limits the size of request bodies for /api/v1/enrich.
+const maxEnrichBodySize = 64 << 20 // 64 MiB
+
+// HandleEnrich adds OSMViews values to a set of geographic locations.
+// Clients POST either a GeoJSON FeatureCollection, or a CSV file whose
+// header row has columns named lat and lng. The response is the same
+// document, with an additional osmviews property for each feature,
+// or an additional osmviews column for each row. For GeoJSON features
+// without Point geometry, the osmviews property is null; in CSV, rows
+// with missing or out-of-range coordinates get an empty value.
+//
+// Like for /api/v1/rank, an optional zoom parameter in the URL
+// selects the overview image from which values are taken.
+func (ws *Webserver) HandleEnrich(w http.ResponseWriter, req *http.Request) {
+	h := w.Header()
+	h.Set("Server", ServerVersion)
+
+	switch req.Method {
+	case http.MethodPost:
+		h.Set("Access-Control-Allow-Origin", "*")
+
+	case http.MethodOptions: // CORS pre-flight
+		h.Set("Allow", "OPTIONS, POST")
+		h.Set("Access-Control-Allow-Methods", "OPTIONS, POST")
+		h.Set("Access-Control-Allow-Headers", "Content-Type")
+		h.Set("Access-Control-Allow-Origin", "*")
+		h.Set("Access-Control-Max-Age", "86400") // 1 day
+		w.WriteHeader(http.StatusNoContent)
+		return
+
+	default:
+		h.Set("Allow", "OPTIONS, POST")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	zoom := 255
+	if z := req.URL.Query().Get("zoom"); z != "" {
+		var err error
+		zoom, err = strconv.Atoi(z)
+		if err != nil || zoom < 0 {
+			http.Error(w, "bad parameter: zoom", http.StatusBadRequest)
+			return
+		}
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	var enrich func(out io.Writer, body io.Reader, img *geotiff.Image) (contentType string, err error)
+	switch mediaType {
+	case "application/geo+json", "application/json":
+		enrich = enrichGeoJSON
+	case "text/csv":
+		enrich = enrichCSV
+	default:
+		msg := "unsupported Content-Type; use application/geo+json or text/csv"
+		http.Error(w, msg, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	g, err := ws.storage.RetrieveGeoTiff("osmviews.tiff")
+	if err != nil {
+		http.NotFound(w, req)
+		return
+	}
+
+	// The output gets buffered, so we can still report errors
+	// with the right status code if they happen late.
+	body := http.MaxBytesReader(w, req.Body, maxEnrichBodySize)
+	var buf bytes.Buffer
+	contentType, err := enrich(&buf, body, g.ImageAt(zoom))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		var lookupErr *lookupError
+		switch {
+		case errors.As(err, &tooLarge):
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		case errors.As(err, &lookupErr):
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		default:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+
+	h.Set("Content-Type", contentType)
+	h.Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Write(buf.Bytes())
+}
+
+// LookupError tells that values could not be read from the GeoTIFF
+// file. Unlike other errors of the enrich endpoint, this is not caused
+// by the client’s request.
+type lookupError struct {
+	err error
+}
+
+func (e *lookupError) Error() string {
+	return e.err.Error()
+}
+
+func (e *lookupError) Unwrap() error {
+	return e.err
+}
+
+// EnrichGeoJSON adds an osmviews property to the features
+// of a GeoJSON FeatureCollection.
+func enrichGeoJSON(out io.Writer, body io.Reader, img *geotiff.Image) (string, error) {
+	var doc map[string]any
+	dec := json.NewDecoder(body)
+	dec.UseNumber() // preserve the precision of numbers in client data
+	if err := dec.Decode(&doc); err != nil {
+		return "", err
+	}
+
+	if doc["type"] != "FeatureCollection" {
+		return "", fmt.Errorf("expected GeoJSON FeatureCollection")
+	}
+	features, ok := doc["features"].([]any)
+	if !ok {
+		return "", fmt.Errorf("expected features in GeoJSON FeatureCollection")
+	}
+
+	points := make([]latLng, len(features))
+	props := make([]map[string]any, len(features))
+	for i, f := range features {
+		feature, ok := f.(map[string]any)
+		if !ok {
+			return "", fmt.Errorf("feature %d is not a JSON object", i)
+		}
+		p, ok := feature["properties"].(map[string]any)
+		if !ok {
+			p = make(map[string]any, 1)
+			feature["properties"] = p
+		}
+		props[i] = p
+		points[i] = geoJSONPoint(feature["geometry"])
+	}
+
+	values, err := lookupValues(img, points)
+	if err != nil {
+		return "", err
+	}
+
+	for i, p := range props {
+		if math.IsNaN(values[i]) {
+			p["osmviews"] = nil
+		} else {
+			p["osmviews"] = json.Number(formatValue(values[i]))
+		}
+	}
+
+	return "application/geo+json", json.NewEncoder(out).Encode(doc)
+}
+
+// GeoJSONPoint returns the location of a GeoJSON Point geometry.
+// For any other geometry, the result is not valid.
+func geoJSONPoint(geometry any) latLng {
+	invalid := latLng{math.NaN(), math.NaN()}
+	g, ok := geometry.(map[string]any)
+	if !ok || g["type"] != "Point" {
+		return invalid
+	}
+
+	coords, ok := g["coordinates"].([]any)
+	if !ok || len(coords) < 2 {
+		return invalid
+	}
+
+	// GeoJSON coordinates are in longitude, latitude order.
+	lng, lngOK := coords[0].(json.Number)
+	lat, latOK := coords[1].(json.Number)
+	if !lngOK || !latOK {
+		return invalid
+	}
+	return parseLatLng(lat.String(), lng.String())
+}
+
+// EnrichCSV adds an osmviews column to a CSV file.
+func enrichCSV(out io.Writer, body io.Reader, img *geotiff.Image) (string, error) {
+	records, err := csv.NewReader(body).ReadAll()
+	if err != nil {
+		return "", err
+	}
+	if len(records) == 0 {
+		return "", fmt.Errorf("expected CSV header row")
+	}
+
+	latCol, lngCol := -1, -1
+	for i, name := range records[0] {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "lat", "latitude":
+			latCol = i
+		case "lng", "lon", "longitude":
+			lngCol = i
+		}
+	}
+	if latCol < 0 || lngCol < 0 {
+		return "", fmt.Errorf("expected CSV columns named lat and lng")
+	}
+
+	rows := records[1:]
+	points := make([]latLng, len(rows))
+	for i, row := range rows {
+		if latCol < len(row) && lngCol < len(row) {
+			points[i] = parseLatLng(row[latCol], row[lngCol])
+		} else {
+			points[i] = latLng{math.NaN(), math.NaN()}
+		}
+	}
+
+	values, err := lookupValues(img, points)
+	if err != nil {
+		return "", err
+	}
+
+	records[0] = append(records[0], "osmviews")
+	for i, row := range rows {
+		val := ""
+		if !math.IsNaN(values[i]) {
+			val = formatValue(values[i])
+		}
+		rows[i] = append(row, val)
+	}
+
+	return "text/csv; charset=utf-8", csv.NewWriter(out).WriteAll(records)
+}
+
+type latLng struct{ lat, lng float64 }
+
+// ParseLatLng parses a pair of WGS84 coordinates. If the coordinates
+// cannot be parsed, or are outside the area covered by the web mercator
+// projection, the result has NaN coordinates.
+func parseLatLng(lat, lng string) latLng {
+	invalid := latLng{math.NaN(), math.NaN()}
+	la, err := strconv.ParseFloat(strings.TrimSpace(lat), 64)
+	if err != nil || la < -geotiff.MaxLatitude || la > geotiff.MaxLatitude {
+		return invalid
+	}
+
+	ln, err := strconv.ParseFloat(strings.TrimSpace(lng), 64)
+	if err != nil || ln < -180 || ln > 180 {
+		return invalid
+	}
+
+	return latLng{la, ln}
+}
+
+// LookupValues returns the values, in weekly views per km², for a set
+// of locations. For locations with NaN coordinates, the value is NaN.
+func lookupValues(img *geotiff.Image, points []latLng) ([]float64, error) {
+	pixels := make([]geotiff.Pixel, 0, len(points))
+	for _, p := range points {
+		if !math.IsNaN(p.lat) && !math.IsNaN(p.lng) {
+			x, y := img.PixelAt(p.lat, p.lng)
+			pixels = append(pixels, geotiff.Pixel{X: x, Y: y})
+		}
+	}
+
+	samples := make([]float32, len(pixels))
+	if err := img.ReadPixels(pixels, 0, samples); err != nil {
+		return nil, &lookupError{err}
+	}
+
+	values := make([]float64, len(points))
+	for i, p := range points {
+		if math.IsNaN(p.lat) || math.IsNaN(p.lng) {
+			values[i] = math.NaN()
+			continue
+		}
+		values[i] = math.Expm1(float64(samples[0]))
+		samples = samples[1:]
+	}
+	return values, nil
+}
+
+// FormatValue formats a value for output. Our GeoTIFF stores
+// 32-bit floating point numbers, so there is no point in returning
+// more digits than needed for distinguishing 32-bit floats.
+func formatValue(val float64) string {
+	return strconv.FormatFloat(val, 'f', -1, 32)
+}
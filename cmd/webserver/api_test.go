@@ -0,0 +1,311 @@
+// SPDX-FileCopyrightText: 2026 Sascha Brawer <sascha@brawer.ch>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/brawer/osmviews/v2/geotiff"
+)
+
+func sendAPIRequest(handler http.HandlerFunc, method, path string) (status int, h http.Header, body []byte, err error) {
+	req := httptest.NewRequest(method, path, nil)
+	w := httptest.NewRecorder()
+	handler(w, req)
+	res := w.Result()
+	defer res.Body.Close()
+	body, err = io.ReadAll(res.Body)
+	return res.StatusCode, res.Header, body, err
+}
+
+func postAPIRequest(handler http.HandlerFunc, path, contentType, body string) (status int, h http.Header, respBody []byte, err error) {
+	req := httptest.NewRequest("POST", path, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	handler(w, req)
+	res := w.Result()
+	defer res.Body.Close()
+	respBody, err = io.ReadAll(res.Body)
+	return res.StatusCode, res.Header, respBody, err
+}
+
+func TestWebserver_Rank(t *testing.T) {
+	status, header, body, err := sendAPIRequest(testWebserver.HandleRank, "GET", "/api/v1/rank?lat=47.3769&lng=8.5417")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status != http.StatusOK {
+		t.Fatalf("want StatusCode %d, got %d", http.StatusOK, status)
+	}
+
+	want := "application/json"
+	if got := header.Get("Content-Type"); got != want {
+		t.Errorf(`want "Content-Type: %s", got "%s"`, want, got)
+	}
+
+	want = "*"
+	if got := header.Get("Access-Control-Allow-Origin"); got != want {
+		t.Errorf(`expected "Access-Control-Allow-Origin: %s", got "%s"`, want, got)
+	}
+
+	var got rankResponse
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if math.Abs(got.Value-1140.70) > 0.01 {
+		t.Errorf("got value=%f, want 1140.70", got.Value)
+	}
+
+	if got.Zoom != 9 || got.Tile != "9/268/179" || got.Date != "2021-11-28" {
+		t.Errorf("got %s", string(body))
+	}
+}
+
+func TestWebserver_RankZoom(t *testing.T) {
+	_, _, body, err := sendAPIRequest(testWebserver.HandleRank, "GET", "/api/v1/rank?lat=47.3769&lng=8.5417&zoom=8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got rankResponse
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Zoom != 8 || got.Tile != "8/134/89" {
+		t.Errorf("got %s", string(body))
+	}
+}
+
+func TestWebserver_RankBadRequest(t *testing.T) {
+	for _, path := range []string{
+		"/api/v1/rank",
+		"/api/v1/rank?lat=47.3769",
+		"/api/v1/rank?lat=91&lng=8.5417",
+		"/api/v1/rank?lat=47.3769&lng=-181",
+		"/api/v1/rank?lat=47.3769&lng=foo",
+		"/api/v1/rank?lat=NaN&lng=8.5417",
+		"/api/v1/rank?lat=47.3769&lng=nan",
+		"/api/v1/rank?lat=Inf&lng=8.5417",
+		"/api/v1/rank?lat=47.3769&lng=-Inf",
+		"/api/v1/rank?lat=47.3769&lng=8.5417&zoom=-1",
+	} {
+		status, _, _, err := sendAPIRequest(testWebserver.HandleRank, "GET", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status != http.StatusBadRequest {
+			t.Errorf("%s: want StatusCode %d, got %d", path, http.StatusBadRequest, status)
+		}
+	}
+}
+
+func TestWebserver_RankMethodNotAllowed(t *testing.T) {
+	status, header, _, err := sendAPIRequest(testWebserver.HandleRank, "POST", "/api/v1/rank?lat=0&lng=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status != http.StatusMethodNotAllowed {
+		t.Errorf("want StatusCode %d, got %d", http.StatusMethodNotAllowed, status)
+	}
+
+	want := "GET, HEAD, OPTIONS"
+	if got := header.Get("Allow"); got != want {
+		t.Errorf(`expected "Allow: %s", got "%s"`, want, got)
+	}
+}
+
+func TestWebserver_EnrichGeoJSON(t *testing.T) {
+	doc := `{
+  "type": "FeatureCollection",
+  "name": "test",
+  "features": [
+    {"type": "Feature", "properties": {"name": "Zürich", "id": 12345678901234567890},
+     "geometry": {"type": "Point", "coordinates": [8.5417, 47.3769]}},
+    {"type": "Feature", "properties": null,
+     "geometry": {"type": "Point", "coordinates": [0.0, 0.0]}},
+    {"type": "Feature", "properties": {"name": "line"},
+     "geometry": {"type": "LineString", "coordinates": [[8.5, 47.3], [8.6, 47.4]]}}
+  ]
+}`
+	status, header, body, err := postAPIRequest(testWebserver.HandleEnrich, "/api/v1/enrich", "application/geo+json", doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status != http.StatusOK {
+		t.Fatalf("want StatusCode %d, got %d: %s", http.StatusOK, status, string(body))
+	}
+
+	want := "application/geo+json"
+	if got := header.Get("Content-Type"); got != want {
+		t.Errorf(`want "Content-Type: %s", got "%s"`, want, got)
+	}
+
+	var got struct {
+		Name     string
+		Features []struct {
+			Properties map[string]any
+		}
+	}
+	dec := json.NewDecoder(strings.NewReader(string(body)))
+	dec.UseNumber()
+	if err := dec.Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Name != "test" || len(got.Features) != 3 {
+		t.Fatalf("got %s", string(body))
+	}
+
+	// Properties of the client, including large numbers, should be
+	// passed through unchanged.
+	p := got.Features[0].Properties
+	if p["name"] != "Zürich" || p["id"] != json.Number("12345678901234567890") {
+		t.Errorf("got properties %v", p)
+	}
+	if p["osmviews"] != json.Number("1140.7006") {
+		t.Errorf("got osmviews=%v, want 1140.7006", p["osmviews"])
+	}
+
+	if v := got.Features[1].Properties["osmviews"]; v != json.Number("0") {
+		t.Errorf("got osmviews=%v, want 0", v)
+	}
+
+	if v, ok := got.Features[2].Properties["osmviews"]; !ok || v != nil {
+		t.Errorf("got osmviews=%v, want null", v)
+	}
+}
+
+func TestWebserver_EnrichCSV(t *testing.T) {
+	doc := "name,Lat,Lng\nZürich,47.3769,8.5417\nNull Island,0,0\nNowhere,,\n"
+	status, header, body, err := postAPIRequest(testWebserver.HandleEnrich, "/api/v1/enrich", "text/csv", doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status != http.StatusOK {
+		t.Fatalf("want StatusCode %d, got %d: %s", http.StatusOK, status, string(body))
+	}
+
+	want := "text/csv; charset=utf-8"
+	if got := header.Get("Content-Type"); got != want {
+		t.Errorf(`want "Content-Type: %s", got "%s"`, want, got)
+	}
+
+	want = "name,Lat,Lng,osmviews\nZürich,47.3769,8.5417,1140.7006\nNull Island,0,0,0\nNowhere,,,\n"
+	if got := string(body); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestWebserver_EnrichBadRequest(t *testing.T) {
+	for _, tc := range []struct{ contentType, body string }{
+		{"application/geo+json", `{"type": "Feature"}`},
+		{"application/geo+json", `{"type": "FeatureCollection", "features": [42]}`},
+		{"application/geo+json", `not JSON`},
+		{"text/csv", "name,x,y\nfoo,1,2\n"},
+		{"text/csv", ""},
+	} {
+		status, _, _, err := postAPIRequest(testWebserver.HandleEnrich, "/api/v1/enrich", tc.contentType, tc.body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status != http.StatusBadRequest {
+			t.Errorf("%q: want StatusCode %d, got %d", tc.body, http.StatusBadRequest, status)
+		}
+	}
+}
+
+func TestWebserver_EnrichUnsupportedMediaType(t *testing.T) {
+	status, _, _, err := postAPIRequest(testWebserver.HandleEnrich, "/api/v1/enrich", "text/plain", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status != http.StatusUnsupportedMediaType {
+		t.Errorf("want StatusCode %d, got %d", http.StatusUnsupportedMediaType, status)
+	}
+}
+
+func TestWebserver_EnrichTooLarge(t *testing.T) {
+	// A GeoJSON document that never ends, padded with whitespace.
+	body := io.MultiReader(
+		strings.NewReader(`{"type": "FeatureCollection", "features": [`),
+		io.LimitReader(&spaces{}, maxEnrichBodySize+1))
+	req := httptest.NewRequest("POST", "/api/v1/enrich", body)
+	req.Header.Set("Content-Type", "application/geo+json")
+	w := httptest.NewRecorder()
+	testWebserver.HandleEnrich(w, req)
+
+	if got, want := w.Code, http.StatusRequestEntityTooLarge; got != want {
+		t.Errorf("want StatusCode %d, got %d", want, got)
+	}
+}
+
+// Spaces is an io.Reader that returns an endless stream of spaces.
+type spaces struct{}
+
+func (s *spaces) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = ' '
+	}
+	return len(p), nil
+}
+
+// If the GeoTIFF file cannot be read, the enrich endpoint should
+// report a server error, and not blame the client’s request.
+func TestWebserver_EnrichLookupError(t *testing.T) {
+	src, err := os.ReadFile(filepath.Join("testdata", "osmviews-20211128.tiff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Overwrite the compressed tile data with zeros, so the file
+	// can still be opened but none of its tiles can be read.
+	r, err := geotiff.NewReader(bytes.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, img := range r.Images {
+		for i, offset := range img.TileOffsets {
+			clear(src[offset : offset+uint64(img.TileByteCounts[i])])
+		}
+	}
+	path := filepath.Join(t.TempDir(), "osmviews-20211128.tiff")
+	if err := os.WriteFile(path, src, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ws := &Webserver{storage: &Storage{
+		files: map[string]*localFile{"osmviews.tiff": {Path: path}},
+	}}
+	for _, tc := range []struct{ contentType, body string }{
+		{"application/geo+json", `{"type": "FeatureCollection", "features": [{"type": "Feature", "geometry": {"type": "Point", "coordinates": [8.5417, 47.3769]}}]}`},
+		{"text/csv", "lat,lng\n47.3769,8.5417\n"},
+	} {
+		status, header, _, err := postAPIRequest(ws.HandleEnrich, "/api/v1/enrich", tc.contentType, tc.body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status != http.StatusInternalServerError {
+			t.Errorf("%s: want StatusCode %d, got %d", tc.contentType, http.StatusInternalServerError, status)
+		}
+		if got, want := header.Get("Content-Type"), "text/plain; charset=utf-8"; got != want {
+			t.Errorf(`%s: want "Content-Type: %s", got "%s"`, tc.contentType, want, got)
+		}
+	}
+}
@@ -27,6 +27,8 @@ var ServerVersion = "OSMViews"
 func main() {
 	port := flag.Int("port", 0, "port for serving HTTP requests")
 	workdir := flag.String("workdir", "webserver-workdir", "path to working directory on local disk")
+	storagedir := flag.String("storagedir", "", "path to local storage directory, used instead of S3")
+	products := flag.String("products", "osmviews,osmviews-z12", "comma-separated products to mirror from storage and serve, along with their statistics")
 	flag.Parse()
 
 	if *port == 0 {
@@ -39,7 +41,13 @@ func main() {
 		}
 	}
 
-	storage, err := NewStorage(*workdir)
+	var storage *Storage
+	var err error
+	if *storagedir != "" {
+		storage, err = NewLocalStorage(*workdir, *storagedir, strings.Split(*products, ","))
+	} else {
+		storage, err = NewStorage(*workdir, strings.Split(*products, ","))
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -55,6 +63,11 @@ func main() {
 	http.HandleFunc("/robots.txt", server.HandleRobotsTxt)
 	http.Handle("/metrics", promhttp.Handler())
 	http.HandleFunc("/download/", server.HandleDownload)
+	http.HandleFunc("/api/v1/rank", server.HandleRank)
+	http.HandleFunc("/api/v1/enrich", server.HandleEnrich)
+	http.HandleFunc("/tiles/", server.HandleTile)
+	http.HandleFunc("/wmts", server.HandleWMTS)
+	http.HandleFunc("/wmts/", server.HandleWMTS)
 	log.Printf("Listening for HTTP requests on port %d", *port)
 	http.ListenAndServe(":"+strconv.Itoa(*port), nil)
 	cancel()
@@ -131,7 +144,16 @@ Ushuaia, Las Reinas:    257.89
 <a href="https://github.com/brawer/osmviews">github.com/brawer/osmviews</a>
 <br/><b>Clients:</b>
 <a href="https://github.com/brawer/osmviews-py">Python</a>
-<br/><b>Download:</b> <a href="download/osmviews.tiff">Cloud-Optimized GeoTIFF</a>
+<br/><b>Download:</b> <a href="download/osmviews.tiff">Cloud-Optimized GeoTIFF</a>`)
+
+	// Only link to companions that storage actually holds, since
+	// their zoom level is configurable and they may be turned off.
+	for _, c := range ws.storage.Companions() {
+		zoom := companionRegexp.FindStringSubmatch(c)[1]
+		fmt.Fprintf(w, ",\n<a href=\"download/%s\">small z%s version</a>", c, zoom)
+	}
+
+	fmt.Fprintf(w, "%s", `
 <br/><b>License:</b> <a href="https://creativecommons.org/publicdomain/zero/1.0/">CC0-1.0</a> (data), <a href="https://en.wikipedia.org/wiki/MIT_License">MIT</a> (code)
 </p>
 
@@ -4,25 +4,34 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"encoding/base32"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/brawer/osmviews/v2/geotiff"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 )
 
 type Storage struct {
-	client  storageClient
-	workdir string
-	mutex   sync.RWMutex
-	files   map[string]*localFile
+	client   storageClient
+	workdir  string
+	products map[string]bool // if nil, all products get mirrored
+	mutex    sync.RWMutex
+	files    map[string]*localFile
+	geoTiffs map[string]*GeoTiff // keyed by localFile.Path
 }
 
 // LocalFile represents a file in the local working directory,
@@ -32,6 +41,7 @@ type localFile struct {
 	ContentType  string
 	ETag         string
 	LastModified time.Time
+	Date         time.Time // date in file name, such as 2021-12-29
 }
 
 // StorageClient is the subset of minio.Client used in this program.
@@ -42,16 +52,25 @@ type storageClient interface {
 }
 
 // NewStorage sets up a client for accessing S3-compatible object storage.
-func NewStorage(workdir string) (*Storage, error) {
-	if err := os.MkdirAll(workdir, 0755); err != nil {
-		return nil, err
-	}
-
+// If the S3_ENDPOINT environment variable is a file URL, such as
+// file:///var/lib/osmviews, the content is taken from a local directory.
+// Only the files of the given products, such as osmviews-z12 for
+// osmviews-z12-20220109.tiff, get mirrored to local disk; if products
+// is nil, all files get mirrored.
+func NewStorage(workdir string, products []string) (*Storage, error) {
 	var config struct{ Endpoint, Key, Secret string }
 	config.Endpoint = os.Getenv("S3_ENDPOINT")
 	config.Key = os.Getenv("S3_KEY")
 	config.Secret = os.Getenv("S3_SECRET")
 
+	if strings.HasPrefix(config.Endpoint, "file:") {
+		u, err := url.Parse(config.Endpoint)
+		if err != nil {
+			return nil, err
+		}
+		return NewLocalStorage(workdir, filepath.FromSlash(u.Path), products)
+	}
+
 	client, err := minio.New(config.Endpoint, &minio.Options{
 		Creds:  credentials.NewStaticV4(config.Key, config.Secret, ""),
 		Secure: true,
@@ -61,14 +80,142 @@ func NewStorage(workdir string) (*Storage, error) {
 	}
 
 	client.SetAppInfo("osmviews-webserver", "0.1")
-	return &Storage{
-		client:  client,
-		workdir: workdir,
-		files:   make(map[string]*localFile, 10),
-	}, nil
+	return newStorage(client, workdir, products)
+}
+
+// NewLocalStorage sets up Storage for serving content from a directory
+// on local disk, such as one populated by the builder when both run on
+// the same host. Like with S3, each bucket is a subdirectory; the files
+// get served from dir/osmviews/public.
+func NewLocalStorage(workdir string, dir string, products []string) (*Storage, error) {
+	st, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !st.IsDir() {
+		return nil, fmt.Errorf("not a directory: %s", dir)
+	}
+	return newStorage(&localStorageClient{root: dir}, workdir, products)
+}
+
+func newStorage(client storageClient, workdir string, products []string) (*Storage, error) {
+	if err := os.MkdirAll(workdir, 0755); err != nil {
+		return nil, err
+	}
+
+	s := &Storage{
+		client:   client,
+		workdir:  workdir,
+		files:    make(map[string]*localFile, 10),
+		geoTiffs: make(map[string]*GeoTiff, 2),
+	}
+	if products != nil {
+		s.products = make(map[string]bool, len(products))
+		for _, p := range products {
+			s.products[p] = true
+		}
+	}
+	return s, nil
+}
+
+// LocalStorageClient is an implementation of storageClient that
+// reads from a directory tree on local disk, with one subdirectory
+// for each bucket.
+type localStorageClient struct {
+	root string
+}
+
+func (c *localStorageClient) ListObjects(ctx context.Context, bucketName string, opts minio.ListObjectsOptions) <-chan minio.ObjectInfo {
+	ch := make(chan minio.ObjectInfo)
+	go func() {
+		defer close(ch)
+		bucket := filepath.Join(c.root, bucketName)
+		err := filepath.WalkDir(bucket, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(bucket, p)
+			if err != nil {
+				return err
+			}
+			key := filepath.ToSlash(rel)
+			if d.IsDir() {
+				// Only descend into directories that can contain
+				// matching keys. Unless the listing is recursive,
+				// S3 does not return keys in nested directories.
+				dirPrefix := key + "/"
+				if key == "." || strings.HasPrefix(opts.Prefix, dirPrefix) {
+					return nil
+				}
+				if opts.Recursive && strings.HasPrefix(dirPrefix, opts.Prefix) {
+					return nil
+				}
+				return filepath.SkipDir
+			}
+			if !strings.HasPrefix(key, opts.Prefix) || strings.HasSuffix(key, ".tmp") {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			// As ETag, we use file size and modification time,
+			// which is what many web servers do for static files.
+			obj := minio.ObjectInfo{
+				Key:          key,
+				Size:         info.Size(),
+				LastModified: info.ModTime().UTC(),
+				ETag:         fmt.Sprintf("%x-%x", info.Size(), info.ModTime().UnixNano()),
+			}
+			select {
+			case ch <- obj:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if err != nil && err != ctx.Err() {
+			ch <- minio.ObjectInfo{Err: err}
+		}
+	}()
+	return ch
 }
 
-var objRegexp = regexp.MustCompile(`public/([a-z\-]+)\-(2[0-9]{7})\.([a-z0-9\.]+)`)
+func (c *localStorageClient) FGetObject(ctx context.Context, bucketName, objectName, filePath string, opts minio.GetObjectOptions) error {
+	if !fs.ValidPath(objectName) {
+		return fmt.Errorf("invalid object name: %s", objectName)
+	}
+	src := filepath.Join(c.root, bucketName, filepath.FromSlash(objectName))
+
+	// If possible, make a hard link instead of copying the content.
+	// When the builder replaces the file, it writes a new file
+	// and renames it, so our link keeps pointing to the old content.
+	os.Remove(filePath)
+	if err := os.Link(src, filePath); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// ObjRegexp matches the servable files in storage, such as
+// public/osmviews-20211128.tiff or public/osmviews-2026Q3-20260927.tiff.
+// The first group is the product name, the second is the date.
+var objRegexp = regexp.MustCompile(`public/([a-zA-Z0-9\-]+?)\-(2[0-9]{7})\.([a-z0-9\.]+)`)
 
 // Reload caches public content from remote object storage to local disk.
 // Any old content (which is not live anymore) is deleted from local disk.
@@ -80,7 +227,7 @@ func (s *Storage) Reload(ctx context.Context) error {
 	})
 	inStorage := make(map[string]minio.ObjectInfo, 5)
 	for obj := range objects {
-		if m := objRegexp.FindStringSubmatch(obj.Key); m != nil {
+		if m := objRegexp.FindStringSubmatch(obj.Key); m != nil && s.mirrors(m[1]) {
 			filename := fmt.Sprintf("%s.%s", m[1], m[3])
 			info := inStorage[filename]
 			if obj.LastModified.After(info.LastModified) {
@@ -117,6 +264,9 @@ func (s *Storage) Reload(ctx context.Context) error {
 			ETag:         obj.ETag,
 			Path:         path,
 		}
+		if m := objRegexp.FindStringSubmatch(obj.Key); m != nil {
+			loc.Date, _ = time.Parse("20060102", m[2])
+		}
 
 		switch filepath.Ext(filename) {
 		case ".gz":
@@ -137,8 +287,17 @@ func (s *Storage) Reload(ctx context.Context) error {
 		live[f.Path] = true
 	}
 
+	// Forget any parsed GeoTIFFs whose files are not live anymore.
+	// We do not close their files here, because they might still be
+	// in use by an in-flight request; once nothing refers to the
+	// GeoTiff anymore, the Go runtime closes the file.
 	s.mutex.Lock()
 	s.files = files
+	for path := range s.geoTiffs {
+		if !live[path] {
+			delete(s.geoTiffs, path)
+		}
+	}
 	s.mutex.Unlock()
 
 	// Clean up workdir so it only contains live files. If we have a new
@@ -170,6 +329,18 @@ func (s *Storage) Reload(ctx context.Context) error {
 	return nil
 }
 
+// Mirrors returns whether Reload should mirror the files of a product
+// to local disk. The builder also publishes seasonal, trend and other
+// files, each of which can be hundreds of megabytes; we only want to
+// keep copies of what we actually serve. Statistics, such as
+// osmviews-stats-20220109.json, get mirrored along with their product.
+func (s *Storage) mirrors(product string) bool {
+	if s.products == nil {
+		return true
+	}
+	return s.products[strings.TrimSuffix(product, "-stats")]
+}
+
 func (s *Storage) Watch(ctx context.Context) error {
 	ticker := time.NewTicker(30 * time.Second)
 	for {
@@ -207,6 +378,28 @@ func (c *Content) Close() error {
 	return c.f.Close()
 }
 
+// CompanionRegexp matches the coarse companions of the main file,
+// such as osmviews-z12.tiff. The group is the zoom level.
+var companionRegexp = regexp.MustCompile(`^osmviews-z([0-9]+)\.tiff$`)
+
+// Companions returns the names of the companion files that are
+// currently servable, such as osmviews-z12.tiff, by increasing zoom.
+func (s *Storage) Companions() []string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var result []string
+	for filename := range s.files {
+		if companionRegexp.MatchString(filename) {
+			result = append(result, filename)
+		}
+	}
+	slices.SortFunc(result, func(a, b string) int {
+		return cmp.Or(len(a)-len(b), strings.Compare(a, b))
+	})
+	return result
+}
+
 func (s *Storage) Retrieve(filename string) (*Content, error) {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
@@ -229,3 +422,64 @@ func (s *Storage) Retrieve(filename string) (*Content, error) {
 	}
 	return c, nil
 }
+
+// GeoTiff is a parsed GeoTIFF file in the local working directory.
+type GeoTiff struct {
+	*geotiff.Reader
+	ETag         string
+	LastModified time.Time
+	Date         time.Time
+}
+
+// RetrieveGeoTiff returns a parsed GeoTIFF file. Because parsing
+// the Image File Directories of a large GeoTIFF takes a while,
+// the result is cached until the file gets replaced by a newer version.
+// Clients can read from the returned GeoTiff concurrently.
+func (s *Storage) RetrieveGeoTiff(filename string) (*GeoTiff, error) {
+	s.mutex.RLock()
+	loc, found := s.files[filename]
+	var g *GeoTiff
+	if found {
+		g = s.geoTiffs[loc.Path]
+	}
+	s.mutex.RUnlock()
+
+	if !found {
+		return nil, fmt.Errorf("not found")
+	}
+	if g != nil {
+		return g, nil
+	}
+
+	f, err := os.Open(loc.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := geotiff.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	g = &GeoTiff{
+		Reader:       reader,
+		ETag:         loc.ETag,
+		LastModified: loc.LastModified,
+		Date:         loc.Date,
+	}
+
+	// Another request might have parsed the same file concurrently.
+	// In that case, we return the other result and close our own file.
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.geoTiffs == nil {
+		s.geoTiffs = make(map[string]*GeoTiff, 2)
+	}
+	if other, ok := s.geoTiffs[loc.Path]; ok {
+		f.Close()
+		return other, nil
+	}
+	s.geoTiffs[loc.Path] = g
+	return g, nil
+}
@@ -6,8 +6,14 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
@@ -117,6 +123,210 @@ func TestStorage_Retrieve(t *testing.T) {
 	}
 }
 
+func TestLocalStorage(t *testing.T) {
+	dir := t.TempDir()
+	lastmod, _ := time.Parse(time.RFC3339, "2021-12-29T13:14:15Z")
+	for _, f := range []struct {
+		path, content string
+		lastmod       time.Time
+	}{
+		{"osmviews/public/hello-20211222.txt", "Old", lastmod.AddDate(0, 0, -7)},
+		{"osmviews/public/hello-20211229.txt", "Hello", lastmod},
+		{"osmviews/public/nested/hello-20220105.txt", "Nested", lastmod.AddDate(0, 0, 7)},
+		{"osmviews/internal/hello-20220105.txt", "Internal", lastmod.AddDate(0, 0, 7)},
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(f.path))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(f.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, f.lastmod, f.lastmod); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	storage, err := NewLocalStorage(t.TempDir(), dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Reload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(storage.files) != 1 {
+		t.Fatalf("got %d files in %v, expected 1", len(storage.files), storage.files)
+	}
+
+	c, err := storage.Retrieve("hello.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if !c.LastModified.Equal(lastmod) {
+		t.Errorf("got LastModified=%v, want %v", c.LastModified, lastmod)
+	}
+
+	if d := storage.files["hello.txt"].Date; d.Format("2006-01-02") != "2021-12-29" {
+		t.Errorf("got Date=%v, want 2021-12-29", d)
+	}
+
+	content, err := io.ReadAll(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "Hello" {
+		t.Errorf(`got %q, want "Hello"`, string(content))
+	}
+}
+
+// The homepage links to the main file and its small companion,
+// so both must be servable after reloading from storage.
+func TestLocalStorage_Companion(t *testing.T) {
+	ws := &Webserver{storage: newTestLocalStorage(t,
+		"osmviews/public/osmviews-20220109.tiff",
+		"osmviews/public/osmviews-z12-20220102.tiff",
+		"osmviews/public/osmviews-z12-20220109.tiff",
+	)}
+	links := homepageLinks(ws)
+	if got, want := strings.Join(links, "|"), "osmviews.tiff|osmviews-z12.tiff"; got != want {
+		t.Errorf("got download links %q, want %q", got, want)
+	}
+	for _, link := range links {
+		rec := httptest.NewRecorder()
+		ws.HandleDownload(rec, httptest.NewRequest("GET", "/download/"+link, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("download/%s: got status %d, want %d", link, rec.Code, http.StatusOK)
+		}
+	}
+
+	c, err := ws.storage.Retrieve("osmviews-z12.tiff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if content, err := io.ReadAll(c); err != nil || string(content) != "osmviews-z12-20220109.tiff" {
+		t.Errorf("got %q, %v; want content of latest companion", content, err)
+	}
+}
+
+// The companion can be at another zoom level, or be turned off,
+// so the homepage must only link to what storage actually holds.
+func TestLocalStorage_CompanionLinks(t *testing.T) {
+	for _, tc := range []struct {
+		paths []string
+		want  string
+	}{
+		{[]string{"osmviews/public/osmviews-20220109.tiff"}, "osmviews.tiff"},
+		{
+			[]string{
+				"osmviews/public/osmviews-20220109.tiff",
+				"osmviews/public/osmviews-z10-20220109.tiff",
+				"osmviews/public/osmviews-2021Q4-20220102.tiff",
+			},
+			"osmviews.tiff|osmviews-z10.tiff",
+		},
+	} {
+		ws := &Webserver{storage: newTestLocalStorage(t, tc.paths...)}
+		if got := strings.Join(homepageLinks(ws), "|"); got != tc.want {
+			t.Errorf("got download links %q, want %q", got, tc.want)
+		}
+		rec := httptest.NewRecorder()
+		ws.HandleMain(rec, httptest.NewRequest("GET", "/", nil))
+		if !strings.Contains(tc.want, "z12") && strings.Contains(rec.Body.String(), "z12") {
+			t.Errorf("homepage mentions z12, but storage holds no such file")
+		}
+	}
+}
+
+// NewTestLocalStorage returns storage that has been reloaded from
+// a local directory holding the given files. Each file contains
+// its own base name.
+func newTestLocalStorage(t *testing.T, paths ...string) *Storage {
+	t.Helper()
+	dir := t.TempDir()
+	for _, path := range paths {
+		path = filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(filepath.Base(path)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	storage, err := NewLocalStorage(t.TempDir(), dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Reload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return storage
+}
+
+// HomepageLinks returns the files that the homepage offers for download.
+func homepageLinks(ws *Webserver) []string {
+	rec := httptest.NewRecorder()
+	ws.HandleMain(rec, httptest.NewRequest("GET", "/", nil))
+	var links []string
+	for _, m := range regexp.MustCompile(`href="download/([^"]+)"`).FindAllStringSubmatch(rec.Body.String(), -1) {
+		links = append(links, m[1])
+	}
+	return links
+}
+
+// Storage holds seasonal, trend and other large files that the
+// webserver does not serve, so it should not mirror them.
+func TestLocalStorage_Products(t *testing.T) {
+	dir := t.TempDir()
+	for _, path := range []string{
+		"osmviews/public/osmviews-20220109.tiff",
+		"osmviews/public/osmviews-stats-20220109.json",
+		"osmviews/public/osmviews-z12-20220109.tiff",
+		"osmviews/public/osmviews-2021Q4-20220109.tiff",
+		"osmviews/public/osmviews-2021Q4-stats-20220109.json",
+		"osmviews/public/osmviews-trend-13w-20220109.tiff",
+		"osmviews/public/osmviews-13w-mean-20220109.tiff",
+	} {
+		path = filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(filepath.Base(path)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	workdir := t.TempDir()
+	storage, err := NewLocalStorage(workdir, dir, []string{"osmviews", "osmviews-z12"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Reload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for filename := range storage.files {
+		got = append(got, filename)
+	}
+	slices.Sort(got)
+	want := "osmviews-stats.json osmviews-z12.tiff osmviews.tiff"
+	if s := strings.Join(got, " "); s != want {
+		t.Errorf("got %q, want %q", s, want)
+	}
+
+	mirrored, err := os.ReadDir(workdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mirrored) != 3 {
+		t.Errorf("got %d files in workdir, want 3", len(mirrored))
+	}
+}
+
 type fakeStorageClient struct {
 	storageClient
 }
@@ -145,10 +355,32 @@ func (s *fakeStorageClient) FGetObject(ctx context.Context, bucketName, objectNa
 	}
 }
 
+func TestStorage_objRegexpGroups(t *testing.T) {
+	for _, tc := range []struct{ path, want string }{
+		{"public/osmviews-20220631.tiff", "osmviews 20220631 tiff"},
+		{"public/osmviews-stats-20220631.json", "osmviews-stats 20220631 json"},
+		{"public/osmviews-2026Q3-20260927.tiff", "osmviews-2026Q3 20260927 tiff"},
+		{"public/osmviews-2026-07-20260802.tiff", "osmviews-2026-07 20260802 tiff"},
+		{"public/osmviews-z12-20220109.tiff", "osmviews-z12 20220109 tiff"},
+	} {
+		m := objRegexp.FindStringSubmatch(tc.path)
+		if m == nil {
+			t.Errorf("should match but does not: %v", tc.path)
+			continue
+		}
+		if got := strings.Join(m[1:], " "); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.path, got, tc.want)
+		}
+	}
+}
+
 func TestStorage_objRegexp(t *testing.T) {
 	for _, s := range []string{
 		"public/osmviews-stats-20220631.json",
 		"public/osmviews-20220631.tiff",
+		"public/osmviews-2026Q3-20260927.tiff",
+		"public/osmviews-2026Q3-stats-20260927.json",
+		"public/osmviews-13w-mean-20220631.tiff",
 	} {
 		if !objRegexp.MatchString(s) {
 			t.Errorf("should match but does not: %v", s)
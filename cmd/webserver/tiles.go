@@ -0,0 +1,266 @@
+// SPDX-FileCopyrightText: 2026 Sascha Brawer <sascha@brawer.ch>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/brawer/osmviews/v2/geotiff"
+)
+
+var tilePathRegexp = regexp.MustCompile(`^/tiles/(\d{1,2})/(\d{1,7})/(\d{1,7})(\.png|\.rgb\.png|\.bin)$`)
+
+// HandleTile serves our data as web mercator tiles, so that the data
+// can be displayed in Leaflet, OpenLayers, JOSM and similar map clients.
+//
+// Example: /tiles/12/2144/1434.png
+//
+// The GeoTIFF contains an overview image for each zoom level,
+// made of 256×256 pixel tiles; this maps one-to-one onto
+// web mercator map tiles. For zoom levels deeper than the
+// most detailed image, we magnify the pixels of that image.
+//
+// Depending on the file extension, we serve different formats:
+//
+//	.png      colorized heatmap
+//	.rgb.png  raw values, packed into the color channels (see renderPackedRGB)
+//	.bin      raw values, as 256×256 little-endian float32 in row-major order
+//
+// The raw values are the same as in the GeoTIFF, ln(1 + weekly views per km²).
+// This allows web frontends to apply their own color ramps and thresholds.
+func (ws *Webserver) HandleTile(w http.ResponseWriter, req *http.Request) {
+	h := w.Header()
+	h.Set("Server", ServerVersion)
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		h.Set("Access-Control-Allow-Origin", "*")
+
+	default:
+		h.Set("Allow", "GET, HEAD")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	m := tilePathRegexp.FindStringSubmatch(req.URL.Path)
+	if m == nil {
+		http.NotFound(w, req)
+		return
+	}
+	zoom, _ := strconv.Atoi(m[1])
+	x, _ := strconv.ParseUint(m[2], 10, 32)
+	y, _ := strconv.ParseUint(m[3], 10, 32)
+
+	g, err := ws.storage.RetrieveGeoTiff("osmviews.tiff")
+	if err != nil {
+		http.NotFound(w, req)
+		return
+	}
+
+	if zoom > int(g.Images[0].Zoom()) || x >= 1<<zoom || y >= 1<<zoom {
+		http.NotFound(w, req)
+		return
+	}
+
+	serveMapTile(w, req, g, m[4], uint8(zoom), uint32(x), uint32(y))
+}
+
+// ServeMapTile renders a map tile in the format given by a file
+// extension, and sends it to the client. The caller must check that
+// the tile coordinates are within range.
+func serveMapTile(w http.ResponseWriter, req *http.Request, g *GeoTiff, ext string, zoom uint8, x, y uint32) {
+	h := w.Header()
+	data, err := readMapTile(g.Reader, zoom, x, y)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// As per https://tools.ietf.org/html/rfc7232, ETag must have quotes.
+	// All tiles get re-rendered when the GeoTIFF changes, so we can
+	// use the ETag of the GeoTIFF for all its tiles.
+	etag := g.ETag
+	var buf bytes.Buffer
+	switch ext {
+	case ".png":
+		if err := png.Encode(&buf, renderHeatmap(data, g.Images[0].MaxValue)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h.Set("Content-Type", "image/png")
+
+	case ".rgb.png":
+		if err := png.Encode(&buf, renderPackedRGB(data)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h.Set("Content-Type", "image/png")
+
+	case ".bin":
+		// Many tiles are uniformly colored, for example in oceans;
+		// these compress extremely well. Because the compressed
+		// representation differs, it needs its own ETag.
+		h.Set("Content-Type", "application/octet-stream")
+		h.Set("Vary", "Accept-Encoding")
+		if strings.Contains(req.Header.Get("Accept-Encoding"), "gzip") {
+			gz := gzip.NewWriter(&buf)
+			if err := binary.Write(gz, binary.LittleEndian, data); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if err := gz.Close(); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			h.Set("Content-Encoding", "gzip")
+			etag = etag + "-gzip"
+		} else {
+			binary.Write(&buf, binary.LittleEndian, data)
+		}
+
+	default:
+		http.NotFound(w, req)
+		return
+	}
+
+	h.Set("ETag", fmt.Sprintf(`"%s"`, etag))
+	h.Set("Cache-Control", "public, max-age=3600")
+	http.ServeContent(w, req, "", g.LastModified, bytes.NewReader(buf.Bytes()))
+}
+
+// ReadMapTile returns the raw pixel values for a web mercator map tile,
+// as 256×256 values in row-major order.
+func readMapTile(r *geotiff.Reader, zoom uint8, x, y uint32) ([]float32, error) {
+	// Find the image whose tiles are at the requested zoom level,
+	// or the most detailed image if the zoom is deeper than that.
+	img := r.Images[0]
+	for _, im := range r.Images {
+		if im.Zoom() == zoom+8 {
+			img = im
+			break
+		}
+	}
+	if img.TileWidth != 256 || img.TileHeight != 256 {
+		return nil, fmt.Errorf("unsupported tile size %dx%d", img.TileWidth, img.TileHeight)
+	}
+
+	// At zoom levels deeper than the image, the map tile is part
+	// of an ancestor tile whose pixels need to be magnified.
+	imgZoom := img.Zoom() - 8
+	if zoom < imgZoom {
+		return nil, fmt.Errorf("no overview image for zoom %d", zoom)
+	}
+	var delta uint8
+	if zoom > imgZoom {
+		delta = zoom - imgZoom
+	}
+	tileX, tileY := x>>delta, y>>delta
+	tileIndex := int(tileY)*img.TilesAcross() + int(tileX)
+	data := make([]float32, 256*256)
+	if err := img.ReadBand(tileIndex, 0, data); err != nil {
+		return nil, err
+	}
+	if delta == 0 {
+		return data, nil
+	}
+
+	result := make([]float32, 256*256)
+	for py := uint32(0); py < 256; py++ {
+		srcY := (y<<8+py)>>delta - tileY<<8
+		for px := uint32(0); px < 256; px++ {
+			srcX := (x<<8+px)>>delta - tileX<<8
+			result[py<<8+px] = data[srcY<<8+srcX]
+		}
+	}
+	return result, nil
+}
+
+// HeatmapPalette maps pixel values to colors. Index 0 is transparent,
+// for places without any views. The other colors go from a dark and
+// translucent purple to an opaque light yellow.
+var heatmapPalette = makeHeatmapPalette()
+
+func makeHeatmapPalette() color.Palette {
+	stops := []struct {
+		pos        float64
+		r, g, b, a float64
+	}{
+		{0.00, 0x30, 0x12, 0x5e, 0x60},
+		{0.25, 0x7b, 0x1f, 0x8c, 0xa0},
+		{0.50, 0xd8, 0x2d, 0x5b, 0xd0},
+		{0.75, 0xf9, 0x8c, 0x0a, 0xf0},
+		{1.00, 0xfc, 0xfd, 0xbf, 0xff},
+	}
+
+	palette := make(color.Palette, 256)
+	palette[0] = color.NRGBA{0, 0, 0, 0}
+	for i := 1; i < 256; i++ {
+		pos := float64(i-1) / 254.0
+		s := 1
+		for s < len(stops)-1 && stops[s].pos < pos {
+			s++
+		}
+		a, b := stops[s-1], stops[s]
+		t := (pos - a.pos) / (b.pos - a.pos)
+		mix := func(u, v float64) uint8 { return uint8(math.Round(u + (v-u)*t)) }
+		palette[i] = color.NRGBA{mix(a.r, b.r), mix(a.g, b.g), mix(a.b, b.b), mix(a.a, b.a)}
+	}
+	return palette
+}
+
+// RenderHeatmap colorizes 256×256 raw pixel values. Because the
+// pixels in our GeoTIFF are logarithmically scaled, we can map them
+// linearly to colors.
+func renderHeatmap(data []float32, maxValue float32) *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, 256, 256), heatmapPalette)
+	if maxValue <= 0 {
+		return img
+	}
+
+	scale := 254.0 / maxValue
+	for i, val := range data {
+		if val > 0 {
+			idx := int(val*scale + 1.5)
+			if idx > 255 {
+				idx = 255
+			}
+			img.Pix[i] = uint8(idx)
+		}
+	}
+	return img
+}
+
+// RenderPackedRGB encodes 256×256 raw pixel values into an opaque
+// RGB image, similar to the “terrain-RGB” tiles of Mapbox.
+// Clients can decode the values like this:
+//
+//	value = (R * 65536 + G * 256 + B) / 100000
+//
+// This covers values from 0 to 167.77215, with a precision of 0.00001.
+// Since our raw values are logarithmically scaled, this is plenty.
+func renderPackedRGB(data []float32) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 256, 256))
+	for i, val := range data {
+		packed := uint32(math.Round(math.Max(float64(val), 0) * 100000))
+		if packed > 0xffffff {
+			packed = 0xffffff
+		}
+		img.Pix[i*4+0] = uint8(packed >> 16)
+		img.Pix[i*4+1] = uint8(packed >> 8)
+		img.Pix[i*4+2] = uint8(packed)
+		img.Pix[i*4+3] = 0xff
+	}
+	return img
+}
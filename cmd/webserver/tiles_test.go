@@ -0,0 +1,202 @@
+// SPDX-FileCopyrightText: 2026 Sascha Brawer <sascha@brawer.ch>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebserver_Tile(t *testing.T) {
+	for _, path := range []string{
+		"/tiles/0/0/0.png",
+		"/tiles/1/1/0.png",
+		"/tiles/9/268/179.png", // magnified from main image
+	} {
+		status, header, body, err := sendAPIRequest(testWebserver.HandleTile, "GET", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if status != http.StatusOK {
+			t.Fatalf("%s: want StatusCode %d, got %d", path, http.StatusOK, status)
+		}
+
+		want := "image/png"
+		if got := header.Get("Content-Type"); got != want {
+			t.Errorf(`%s: want "Content-Type: %s", got "%s"`, path, want, got)
+		}
+
+		want = `"ETag-456"`
+		if got := header.Get("ETag"); got != want {
+			t.Errorf(`%s: want "ETag: %s", got "%s"`, path, want, got)
+		}
+
+		img, err := png.Decode(bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if b := img.Bounds(); b.Dx() != 256 || b.Dy() != 256 {
+			t.Errorf("%s: got bounds %v", path, b)
+		}
+
+		// Zürich is visible on all these tiles.
+		visible := false
+		for y := 0; y < 256; y++ {
+			for x := 0; x < 256; x++ {
+				if _, _, _, a := img.At(x, y).RGBA(); a > 0 {
+					visible = true
+				}
+			}
+		}
+		if !visible {
+			t.Errorf("%s: all pixels are transparent", path)
+		}
+	}
+}
+
+func TestWebserver_TileBinary(t *testing.T) {
+	g, err := testWebserver.storage.RetrieveGeoTiff("osmviews.tiff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := readMapTile(g.Reader, 1, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, encoding := range []string{"", "gzip"} {
+		req := httptest.NewRequest("GET", "/tiles/1/1/0.bin", nil)
+		if encoding != "" {
+			req.Header.Set("Accept-Encoding", encoding)
+		}
+		w := httptest.NewRecorder()
+		testWebserver.HandleTile(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("want StatusCode %d, got %d", http.StatusOK, res.StatusCode)
+		}
+
+		if got := res.Header.Get("Content-Encoding"); got != encoding {
+			t.Errorf(`want "Content-Encoding: %s", got "%s"`, encoding, got)
+		}
+
+		var body io.Reader = res.Body
+		if encoding == "gzip" {
+			if body, err = gzip.NewReader(res.Body); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		got := make([]float32, 256*256)
+		if err := binary.Read(body, binary.LittleEndian, got); err != nil {
+			t.Fatal(err)
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Fatalf("%q: value[%d]: got %f, want %f", encoding, i, got[i], want[i])
+			}
+		}
+	}
+}
+
+func TestWebserver_TilePackedRGB(t *testing.T) {
+	g, err := testWebserver.storage.RetrieveGeoTiff("osmviews.tiff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := readMapTile(g.Reader, 1, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, header, body, err := sendAPIRequest(testWebserver.HandleTile, "GET", "/tiles/1/1/0.rgb.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != http.StatusOK {
+		t.Fatalf("want StatusCode %d, got %d", http.StatusOK, status)
+	}
+	if got := header.Get("Content-Type"); got != "image/png" {
+		t.Errorf(`want "Content-Type: image/png", got "%s"`, got)
+	}
+
+	img, err := png.Decode(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 256; y++ {
+		for x := 0; x < 256; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			got := float64(int(c.R)*65536+int(c.G)*256+int(c.B)) / 100000
+			if w := float64(want[y*256+x]); math.Abs(got-w) > 0.00001 || c.A != 0xff {
+				t.Fatalf("pixel (%d, %d): got %v = %f, want %f", x, y, c, got, w)
+			}
+		}
+	}
+}
+
+func TestWebserver_TileNotFound(t *testing.T) {
+	for _, path := range []string{
+		"/tiles/10/0/0.png", // deeper than main image
+		"/tiles/1/2/0.png",
+		"/tiles/1/0/2.png",
+		"/tiles/1/0/0.jpg",
+		"/tiles/1/0/0.rgb.bin",
+		"/tiles/foo",
+	} {
+		status, _, _, err := sendAPIRequest(testWebserver.HandleTile, "GET", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status != http.StatusNotFound {
+			t.Errorf("%s: want StatusCode %d, got %d", path, http.StatusNotFound, status)
+		}
+	}
+}
+
+func TestReadMapTile_Magnified(t *testing.T) {
+	g, err := testWebserver.storage.RetrieveGeoTiff("osmviews.tiff")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// At zoom 9, the map tile is a single pixel of the main image.
+	data, err := readMapTile(g.Reader, 9, 268, 179)
+	if err != nil {
+		t.Fatal(err)
+	}
+	val, err := g.ValueAt(47.3769, 8.5417, 255)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, got := range data {
+		if got != val {
+			t.Fatalf("data[%d]: got %f, want %f", i, got, val)
+		}
+	}
+}
+
+func TestHeatmapPalette(t *testing.T) {
+	if got := heatmapPalette[0]; got != (color.NRGBA{0, 0, 0, 0}) {
+		t.Errorf("palette[0]: got %v, want transparent", got)
+	}
+	if got := heatmapPalette[1]; got != (color.NRGBA{0x30, 0x12, 0x5e, 0x60}) {
+		t.Errorf("palette[1]: got %v", got)
+	}
+	if got := heatmapPalette[255]; got != (color.NRGBA{0xfc, 0xfd, 0xbf, 0xff}) {
+		t.Errorf("palette[255]: got %v", got)
+	}
+}
@@ -205,5 +205,21 @@ func makeTestWebserver() *Webserver {
 		LastModified: lastmod,
 	}
 
+	// For testing the API, we serve a GeoTIFF that was produced
+	// by the osmviews-builder pipeline at zoom level 9, from the
+	// tile logs in osmviews-builder/testdata/zurich-2021-W47.br.
+	tiffPath, err := filepath.Abs(filepath.Join("testdata", "osmviews-20211128.tiff"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	date, _ := time.Parse("2006-01-02", "2021-11-28")
+	storage.files["osmviews.tiff"] = &localFile{
+		Path:         tiffPath,
+		ContentType:  "image/tiff",
+		ETag:         "ETag-456",
+		LastModified: lastmod,
+		Date:         date,
+	}
+
 	return &Webserver{storage: storage}
 }
@@ -0,0 +1,282 @@
+// SPDX-FileCopyrightText: 2026 Sascha Brawer <sascha@brawer.ch>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// HandleWMTS implements the OpenGIS Web Map Tile Service (WMTS),
+// version 1.0.0, in both its key-value-pair (KVP) and RESTful encodings.
+// The served layer is the same heatmap as in HandleTile, in the
+// GoogleMapsCompatible tile matrix set (EPSG:3857, 256×256 pixels).
+//
+// KVP:  /wmts?SERVICE=WMTS&REQUEST=GetCapabilities
+// KVP:  /wmts?SERVICE=WMTS&REQUEST=GetTile&VERSION=1.0.0&LAYER=osmviews&STYLE=default&TILEMATRIXSET=GoogleMapsCompatible&TILEMATRIX=12&TILEROW=1434&TILECOL=2144&FORMAT=image/png
+// REST: /wmts/1.0.0/WMTSCapabilities.xml
+// REST: /wmts/1.0.0/osmviews/default/GoogleMapsCompatible/12/1434/2144.png
+//
+// http://www.opengeospatial.org/standards/wmts
+func (ws *Webserver) HandleWMTS(w http.ResponseWriter, req *http.Request) {
+	h := w.Header()
+	h.Set("Server", ServerVersion)
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		h.Set("Access-Control-Allow-Origin", "*")
+
+	default:
+		h.Set("Allow", "GET, HEAD")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if req.URL.Path == "/wmts/1.0.0/WMTSCapabilities.xml" {
+		ws.handleWMTSCapabilities(w, req)
+		return
+	}
+
+	if m := wmtsTilePathRegexp.FindStringSubmatch(req.URL.Path); m != nil {
+		ws.handleWMTSTile(w, req, m[1], m[2], m[3])
+		return
+	}
+
+	if req.URL.Path != "/wmts" {
+		http.NotFound(w, req)
+		return
+	}
+
+	// In the KVP encoding, parameter names are case-insensitive.
+	params := make(map[string]string, 10)
+	for key, values := range req.URL.Query() {
+		params[strings.ToUpper(key)] = values[0]
+	}
+
+	if service, ok := params["SERVICE"]; !ok {
+		wmtsException(w, "MissingParameterValue", "service", "missing parameter: SERVICE")
+		return
+	} else if service != "WMTS" {
+		wmtsException(w, "InvalidParameterValue", "service", "SERVICE must be WMTS")
+		return
+	}
+
+	switch params["REQUEST"] {
+	case "GetCapabilities":
+		ws.handleWMTSCapabilities(w, req)
+
+	case "GetTile":
+		for _, p := range []string{"VERSION", "LAYER", "STYLE", "FORMAT", "TILEMATRIXSET", "TILEMATRIX", "TILEROW", "TILECOL"} {
+			if _, ok := params[p]; !ok {
+				msg := fmt.Sprintf("missing parameter: %s", p)
+				wmtsException(w, "MissingParameterValue", strings.ToLower(p), msg)
+				return
+			}
+		}
+		for _, p := range []struct{ name, want string }{
+			{"VERSION", "1.0.0"},
+			{"LAYER", "osmviews"},
+			{"STYLE", "default"},
+			{"FORMAT", "image/png"},
+			{"TILEMATRIXSET", "GoogleMapsCompatible"},
+		} {
+			if params[p.name] != p.want {
+				msg := fmt.Sprintf("%s must be %s", p.name, p.want)
+				wmtsException(w, "InvalidParameterValue", strings.ToLower(p.name), msg)
+				return
+			}
+		}
+		ws.handleWMTSTile(w, req, params["TILEMATRIX"], params["TILEROW"], params["TILECOL"])
+
+	case "":
+		wmtsException(w, "MissingParameterValue", "request", "missing parameter: REQUEST")
+
+	default:
+		wmtsException(w, "OperationNotSupported", "request", "REQUEST must be GetCapabilities or GetTile")
+	}
+}
+
+var wmtsTilePathRegexp = regexp.MustCompile(`^/wmts/1\.0\.0/osmviews/default/GoogleMapsCompatible/(\d+)/(\d+)/(\d+)\.png$`)
+
+func (ws *Webserver) handleWMTSTile(w http.ResponseWriter, req *http.Request, tileMatrix, tileRow, tileCol string) {
+	g, err := ws.storage.RetrieveGeoTiff("osmviews.tiff")
+	if err != nil {
+		http.NotFound(w, req)
+		return
+	}
+
+	maxZoom := int(g.Images[0].Zoom())
+	zoom, err := strconv.Atoi(tileMatrix)
+	if err != nil || zoom < 0 || zoom > maxZoom {
+		wmtsException(w, "InvalidParameterValue", "tilematrix", "unknown TileMatrix")
+		return
+	}
+
+	row, rowErr := strconv.ParseUint(tileRow, 10, 32)
+	col, colErr := strconv.ParseUint(tileCol, 10, 32)
+	if rowErr != nil || row >= 1<<zoom {
+		wmtsException(w, "TileOutOfRange", "tilerow", "TileRow out of range")
+		return
+	}
+	if colErr != nil || col >= 1<<zoom {
+		wmtsException(w, "TileOutOfRange", "tilecol", "TileCol out of range")
+		return
+	}
+
+	serveMapTile(w, req, g, ".png", uint8(zoom), uint32(col), uint32(row))
+}
+
+func (ws *Webserver) handleWMTSCapabilities(w http.ResponseWriter, req *http.Request) {
+	g, err := ws.storage.RetrieveGeoTiff("osmviews.tiff")
+	if err != nil {
+		http.NotFound(w, req)
+		return
+	}
+
+	// Behind the reverse proxy of Wikimedia Toolforge, we receive
+	// plain HTTP requests; the proxy tells us the original scheme.
+	scheme := "http"
+	if req.TLS != nil || req.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+
+	// Scale denominators of the GoogleMapsCompatible well-known
+	// scale set, as per OGC WMTS 1.0.0 specification, Annex E.4.
+	type tileMatrix struct {
+		Zoom             int
+		ScaleDenominator string
+		MatrixSize       int
+	}
+	maxZoom := int(g.Images[0].Zoom())
+	matrices := make([]tileMatrix, 0, maxZoom+1)
+	for zoom := 0; zoom <= maxZoom; zoom++ {
+		scale := 559082264.0287178 / math.Exp2(float64(zoom))
+		matrices = append(matrices, tileMatrix{
+			Zoom:             zoom,
+			ScaleDenominator: strconv.FormatFloat(scale, 'f', -1, 64),
+			MatrixSize:       1 << zoom,
+		})
+	}
+
+	var buf bytes.Buffer
+	err = wmtsCapabilitiesTemplate.Execute(&buf, struct {
+		BaseURL  string
+		Matrices []tileMatrix
+	}{
+		BaseURL:  fmt.Sprintf("%s://%s", scheme, req.Host),
+		Matrices: matrices,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h := w.Header()
+	h.Set("ETag", fmt.Sprintf(`"%s"`, g.ETag))
+	h.Set("Content-Type", "application/xml")
+	http.ServeContent(w, req, "", g.LastModified, bytes.NewReader(buf.Bytes()))
+}
+
+// WmtsException sends an OGC exception report to the client.
+// OGC Web Services Common Standard 2.0, section 8.
+func wmtsException(w http.ResponseWriter, code, locator, text string) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	buf.WriteString(`<ExceptionReport xmlns="http://www.opengis.net/ows/1.1" version="1.0.0" xml:lang="en">`)
+	fmt.Fprintf(&buf, `<Exception exceptionCode="%s" locator="%s"><ExceptionText>`, code, locator)
+	xml.EscapeText(&buf, []byte(text))
+	buf.WriteString("</ExceptionText></Exception></ExceptionReport>\n")
+
+	h := w.Header()
+	h.Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write(buf.Bytes())
+}
+
+var wmtsCapabilitiesTemplate = template.Must(template.New("WMTSCapabilities.xml").Funcs(template.FuncMap{
+	"xml": func(s string) string {
+		var buf bytes.Buffer
+		xml.EscapeText(&buf, []byte(s))
+		return buf.String()
+	},
+}).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<Capabilities xmlns="http://www.opengis.net/wmts/1.0" xmlns:ows="http://www.opengis.net/ows/1.1" xmlns:xlink="http://www.w3.org/1999/xlink" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:schemaLocation="http://www.opengis.net/wmts/1.0 http://schemas.opengis.net/wmts/1.0/wmtsGetCapabilities_response.xsd" version="1.0.0">
+  <ows:ServiceIdentification>
+    <ows:Title>OSMViews</ows:Title>
+    <ows:Abstract>World-wide ranking of geographic locations based on OpenStreetMap tile logs.</ows:Abstract>
+    <ows:ServiceType>OGC WMTS</ows:ServiceType>
+    <ows:ServiceTypeVersion>1.0.0</ows:ServiceTypeVersion>
+    <ows:Fees>none</ows:Fees>
+    <ows:AccessConstraints>none</ows:AccessConstraints>
+  </ows:ServiceIdentification>
+  <ows:OperationsMetadata>
+    <ows:Operation name="GetCapabilities">
+      <ows:DCP>
+        <ows:HTTP>
+          <ows:Get xlink:href="{{xml .BaseURL}}/wmts/1.0.0/WMTSCapabilities.xml">
+            <ows:Constraint name="GetEncoding"><ows:AllowedValues><ows:Value>RESTful</ows:Value></ows:AllowedValues></ows:Constraint>
+          </ows:Get>
+          <ows:Get xlink:href="{{xml .BaseURL}}/wmts?">
+            <ows:Constraint name="GetEncoding"><ows:AllowedValues><ows:Value>KVP</ows:Value></ows:AllowedValues></ows:Constraint>
+          </ows:Get>
+        </ows:HTTP>
+      </ows:DCP>
+    </ows:Operation>
+    <ows:Operation name="GetTile">
+      <ows:DCP>
+        <ows:HTTP>
+          <ows:Get xlink:href="{{xml .BaseURL}}/wmts/1.0.0/">
+            <ows:Constraint name="GetEncoding"><ows:AllowedValues><ows:Value>RESTful</ows:Value></ows:AllowedValues></ows:Constraint>
+          </ows:Get>
+          <ows:Get xlink:href="{{xml .BaseURL}}/wmts?">
+            <ows:Constraint name="GetEncoding"><ows:AllowedValues><ows:Value>KVP</ows:Value></ows:AllowedValues></ows:Constraint>
+          </ows:Get>
+        </ows:HTTP>
+      </ows:DCP>
+    </ows:Operation>
+  </ows:OperationsMetadata>
+  <Contents>
+    <Layer>
+      <ows:Title>OSMViews</ows:Title>
+      <ows:Abstract>OpenStreetMap view density, in weekly user views per km².</ows:Abstract>
+      <ows:WGS84BoundingBox>
+        <ows:LowerCorner>-180 -85.0511287798066</ows:LowerCorner>
+        <ows:UpperCorner>180 85.0511287798066</ows:UpperCorner>
+      </ows:WGS84BoundingBox>
+      <ows:Identifier>osmviews</ows:Identifier>
+      <Style isDefault="true">
+        <ows:Identifier>default</ows:Identifier>
+      </Style>
+      <Format>image/png</Format>
+      <TileMatrixSetLink>
+        <TileMatrixSet>GoogleMapsCompatible</TileMatrixSet>
+      </TileMatrixSetLink>
+      <ResourceURL format="image/png" resourceType="tile" template="{{xml .BaseURL}}/wmts/1.0.0/osmviews/{Style}/{TileMatrixSet}/{TileMatrix}/{TileRow}/{TileCol}.png"/>
+    </Layer>
+    <TileMatrixSet>
+      <ows:Identifier>GoogleMapsCompatible</ows:Identifier>
+      <ows:SupportedCRS>urn:ogc:def:crs:EPSG::3857</ows:SupportedCRS>
+      <WellKnownScaleSet>urn:ogc:def:wkss:OGC:1.0:GoogleMapsCompatible</WellKnownScaleSet>
+{{- range .Matrices}}
+      <TileMatrix>
+        <ows:Identifier>{{.Zoom}}</ows:Identifier>
+        <ScaleDenominator>{{.ScaleDenominator}}</ScaleDenominator>
+        <TopLeftCorner>-20037508.3427892 20037508.3427892</TopLeftCorner>
+        <TileWidth>256</TileWidth>
+        <TileHeight>256</TileHeight>
+        <MatrixWidth>{{.MatrixSize}}</MatrixWidth>
+        <MatrixHeight>{{.MatrixSize}}</MatrixHeight>
+      </TileMatrix>
+{{- end}}
+    </TileMatrixSet>
+  </Contents>
+</Capabilities>
+`))
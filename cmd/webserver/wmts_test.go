@@ -0,0 +1,141 @@
+// SPDX-FileCopyrightText: 2026 Sascha Brawer <sascha@brawer.ch>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestWebserver_WMTSCapabilities(t *testing.T) {
+	for _, path := range []string{
+		"/wmts?SERVICE=WMTS&REQUEST=GetCapabilities",
+		"/wmts?service=WMTS&request=GetCapabilities&version=1.0.0",
+		"/wmts/1.0.0/WMTSCapabilities.xml",
+	} {
+		status, header, body, err := sendAPIRequest(testWebserver.HandleWMTS, "GET", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if status != http.StatusOK {
+			t.Fatalf("%s: want StatusCode %d, got %d: %s", path, http.StatusOK, status, string(body))
+		}
+
+		want := "application/xml"
+		if got := header.Get("Content-Type"); got != want {
+			t.Errorf(`%s: want "Content-Type: %s", got "%s"`, path, want, got)
+		}
+
+		var caps struct {
+			Contents struct {
+				Layer struct {
+					Identifier  string `xml:"http://www.opengis.net/ows/1.1 Identifier"`
+					ResourceURL struct {
+						Template string `xml:"template,attr"`
+					}
+				}
+				TileMatrixSet struct {
+					TileMatrix []struct {
+						Identifier       string `xml:"http://www.opengis.net/ows/1.1 Identifier"`
+						ScaleDenominator float64
+						MatrixWidth      int
+					}
+				}
+			}
+		}
+		if err := xml.Unmarshal(body, &caps); err != nil {
+			t.Fatal(err)
+		}
+
+		layer := caps.Contents.Layer
+		if layer.Identifier != "osmviews" {
+			t.Errorf("%s: got layer %q, want osmviews", path, layer.Identifier)
+		}
+
+		wantTemplate := "http://example.com/wmts/1.0.0/osmviews/{Style}/{TileMatrixSet}/{TileMatrix}/{TileRow}/{TileCol}.png"
+		if layer.ResourceURL.Template != wantTemplate {
+			t.Errorf("%s: got template %q, want %q", path, layer.ResourceURL.Template, wantTemplate)
+		}
+
+		// The test GeoTIFF goes down to zoom level 9.
+		matrices := caps.Contents.TileMatrixSet.TileMatrix
+		if len(matrices) != 10 {
+			t.Fatalf("%s: got %d TileMatrix, want 10", path, len(matrices))
+		}
+		m := matrices[9]
+		if m.Identifier != "9" || m.MatrixWidth != 512 || int(m.ScaleDenominator) != 1091957 {
+			t.Errorf("%s: got TileMatrix %+v", path, m)
+		}
+	}
+}
+
+func TestWebserver_WMTSTile(t *testing.T) {
+	for _, path := range []string{
+		"/wmts?SERVICE=WMTS&REQUEST=GetTile&VERSION=1.0.0&LAYER=osmviews&STYLE=default&TILEMATRIXSET=GoogleMapsCompatible&TILEMATRIX=9&TILEROW=179&TILECOL=268&FORMAT=image/png",
+		"/wmts/1.0.0/osmviews/default/GoogleMapsCompatible/9/179/268.png",
+	} {
+		status, header, body, err := sendAPIRequest(testWebserver.HandleWMTS, "GET", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if status != http.StatusOK {
+			t.Fatalf("%s: want StatusCode %d, got %d: %s", path, http.StatusOK, status, string(body))
+		}
+
+		want := "image/png"
+		if got := header.Get("Content-Type"); got != want {
+			t.Errorf(`%s: want "Content-Type: %s", got "%s"`, path, want, got)
+		}
+	}
+}
+
+func TestWebserver_WMTSException(t *testing.T) {
+	getTile := "/wmts?SERVICE=WMTS&REQUEST=GetTile&VERSION=1.0.0&LAYER=osmviews&STYLE=default&TILEMATRIXSET=GoogleMapsCompatible&FORMAT=image/png"
+	for _, tc := range []struct{ path, code string }{
+		{"/wmts?REQUEST=GetCapabilities", "MissingParameterValue"},
+		{"/wmts?SERVICE=WMS&REQUEST=GetCapabilities", "InvalidParameterValue"},
+		{"/wmts?SERVICE=WMTS", "MissingParameterValue"},
+		{"/wmts?SERVICE=WMTS&REQUEST=GetFeatureInfo", "OperationNotSupported"},
+		{getTile + "&TILEMATRIX=9&TILEROW=179", "MissingParameterValue"},
+		{strings.Replace(getTile, "osmviews", "other", 1) + "&TILEMATRIX=9&TILEROW=179&TILECOL=268", "InvalidParameterValue"},
+		{getTile + "&TILEMATRIX=10&TILEROW=179&TILECOL=268", "InvalidParameterValue"},
+		{getTile + "&TILEMATRIX=9&TILEROW=512&TILECOL=268", "TileOutOfRange"},
+		{getTile + "&TILEMATRIX=9&TILEROW=179&TILECOL=-1", "TileOutOfRange"},
+	} {
+		status, _, body, err := sendAPIRequest(testWebserver.HandleWMTS, "GET", tc.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if status != http.StatusBadRequest {
+			t.Errorf("%s: want StatusCode %d, got %d", tc.path, http.StatusBadRequest, status)
+		}
+
+		var report struct {
+			Exception struct {
+				Code string `xml:"exceptionCode,attr"`
+			}
+		}
+		if err := xml.Unmarshal(body, &report); err != nil {
+			t.Fatal(err)
+		}
+		if report.Exception.Code != tc.code {
+			t.Errorf("%s: got exceptionCode=%q, want %q", tc.path, report.Exception.Code, tc.code)
+		}
+	}
+}
+
+func TestWebserver_WMTSNotFound(t *testing.T) {
+	status, _, _, err := sendAPIRequest(testWebserver.HandleWMTS, "GET", "/wmts/1.0.0/other/default/GoogleMapsCompatible/0/0/0.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != http.StatusNotFound {
+		t.Errorf("want StatusCode %d, got %d", http.StatusNotFound, status)
+	}
+}
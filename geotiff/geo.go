@@ -0,0 +1,253 @@
+// SPDX-FileCopyrightText: 2026 Sascha Brawer <sascha@brawer.ch>
+// SPDX-License-Identifier: MIT
+
+package geotiff
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// MaxLatitude is the northernmost latitude covered by the web mercator
+// projection. For the southernmost, use -MaxLatitude.
+const MaxLatitude = 85.0511287798066
+
+// WorldExtent is the width and height of the world in web mercator
+// model coordinates, in meters. Our pipeline writes it as the WGS 84
+// circumference of the Earth at the equator.
+const worldExtent = 40075017.0
+
+// Georeference tells how the pixels of a GeoTIFF image relate to
+// the model space of its coordinate reference system.
+// https://docs.ogc.org/is/19-008r4/19-008r4.html
+type Georeference struct {
+	// GeoKeys maps the IDs of GeoKeys to their values. Keys whose
+	// values are stored in GeoDoubleParams or GeoAsciiParams are
+	// not included.
+	GeoKeys map[uint16]uint16
+
+	// Tiepoint maps the raster point (I, J, K) to the model point
+	// (X, Y, Z), in this order.
+	Tiepoint []float64
+
+	// PixelScale is the size of a pixel of the main image in model
+	// space, along the X, Y and Z axes.
+	PixelScale []float64
+}
+
+const (
+	geoKeyModelType    = 1024
+	geoKeyRasterType   = 1025
+	geoKeyProjectedCRS = 3072
+)
+
+// ReadGeoTag parses a GeoTIFF tag of the main image into t.Georeference.
+func (t *Reader) readGeoTag(tag, typ uint16, count uint64, field []byte) error {
+	data, err := t.readEntry(typ, count, field)
+	if err != nil {
+		return err
+	}
+
+	switch tag {
+	case 33550, 33922: // ModelPixelScale, ModelTiepoint
+		if typ != 12 {
+			return fmt.Errorf("tag %d has type=%d, want 12", tag, typ)
+		}
+		values := make([]float64, count)
+		for i := range values {
+			values[i] = math.Float64frombits(t.order.Uint64(data[8*i:]))
+		}
+		if tag == 33550 {
+			t.Georeference.PixelScale = values
+		} else {
+			t.Georeference.Tiepoint = values
+		}
+
+	case 34735: // GeoKeyDirectory
+		if typ != 3 {
+			return fmt.Errorf("GeoKeyDirectory has type=%d, want 3", typ)
+		}
+		dir := make([]uint16, count)
+		for i := range dir {
+			dir[i] = t.order.Uint16(data[2*i:])
+		}
+
+		// The directory starts with a header of four values, the last
+		// of which is the number of keys; each key has four values.
+		if len(dir) < 4 || len(dir) < 4+4*int(dir[3]) {
+			return fmt.Errorf("malformed GeoKeyDirectory")
+		}
+		keys := make(map[uint16]uint16, dir[3])
+		for i := 0; i < int(dir[3]); i++ {
+			key := dir[4+4*i : 8+4*i]
+			if key[1] == 0 { // value stored inline
+				keys[key[0]] = key[3]
+			}
+		}
+		t.Georeference.GeoKeys = keys
+	}
+
+	return nil
+}
+
+// Check returns an error unless g puts img onto the entire world,
+// in web mercator projection. This is how our pipeline writes its
+// GeoTIFFs, and the point access functions of this package rely on it.
+func (g *Georeference) check(img *Image) error {
+	if g.GeoKeys == nil || len(g.Tiepoint) < 6 || len(g.PixelScale) < 2 {
+		return fmt.Errorf("missing GeoTIFF tags")
+	}
+	if t := g.GeoKeys[geoKeyModelType]; t != 1 {
+		return fmt.Errorf("got ModelType=%d, want 1 (projected)", t)
+	}
+	if crs := g.GeoKeys[geoKeyProjectedCRS]; crs != 3857 {
+		return fmt.Errorf("got ProjectedCRS=%d, want 3857 (web mercator)", crs)
+	}
+	if t := g.GeoKeys[geoKeyRasterType]; t != 1 {
+		return fmt.Errorf("got RasterType=%d, want 1 (PixelIsArea)", t)
+	}
+
+	// Our pipeline writes the tiepoint rounded to centimeters, which
+	// is 16 cm off. Allow for this, since pixels are much larger.
+	const tolerance = 1.0 // meters
+	near := func(a, b float64) bool { return math.Abs(a-b) <= tolerance }
+	if g.Tiepoint[0] != 0 || g.Tiepoint[1] != 0 ||
+		!near(g.Tiepoint[3], -worldExtent/2) || !near(g.Tiepoint[4], worldExtent/2) {
+		return fmt.Errorf("image does not start at the north-west corner of the world")
+	}
+	if !near(g.PixelScale[0]*float64(img.Width), worldExtent) ||
+		!near(g.PixelScale[1]*float64(img.Height), worldExtent) {
+		return fmt.Errorf("image does not cover the entire world")
+	}
+	return nil
+}
+
+// ImageAt returns the most detailed image whose zoom level is not
+// deeper than zoom. If all images are more detailed than requested,
+// the coarsest overview gets returned.
+func (r *Reader) ImageAt(zoom int) *Image {
+	for _, img := range r.Images {
+		if int(img.Zoom()) <= zoom {
+			return img
+		}
+	}
+	return r.Images[len(r.Images)-1]
+}
+
+// ValueAt returns the sample of the first band at a WGS84 location,
+// taken from the image returned by ImageAt(zoom). In our GeoTIFFs,
+// this is ln(1 + weekly views per km²) for the pixel.
+func (r *Reader) ValueAt(lat, lng float64, zoom int) (float32, error) {
+	img := r.ImageAt(zoom)
+	x, y := img.PixelAt(lat, lng)
+	return img.ReadPixel(x, y, 0)
+}
+
+// PixelAt returns the coordinates of the pixel that contains
+// a WGS84 location. Locations outside the area covered by the web
+// mercator projection get mapped to the nearest pixel at the border.
+func (img *Image) PixelAt(lat, lng float64) (x, y uint32) {
+	// https://wiki.openstreetmap.org/wiki/Slippy_map_tilenames
+	latRad := lat * (math.Pi / 180.0)
+	fx := (lng + 180.0) / 360.0 * float64(img.Width)
+	fy := (1.0 - math.Asinh(math.Tan(latRad))/math.Pi) / 2.0 * float64(img.Height)
+	x = uint32(math.Min(math.Max(fx, 0), float64(img.Width-1)))
+	y = uint32(math.Min(math.Max(fy, 0), float64(img.Height-1)))
+	return x, y
+}
+
+// ReadPixel returns the sample of a band at pixel (x, y).
+func (img *Image) ReadPixel(x, y uint32, band int) (float32, error) {
+	var val [1]float32
+	if err := img.ReadPixels([]Pixel{{x, y}}, band, val[:]); err != nil {
+		return 0, err
+	}
+	return val[0], nil
+}
+
+// Pixel is the position of a pixel within an image.
+type Pixel struct {
+	X, Y uint32
+}
+
+// ReadPixels reads the samples of a band for a set of pixels, storing
+// the sample for pixels[i] into data[i]. Nearby pixels are often in
+// the same tile, so the pixels get read in tile order; this way, each
+// tile gets decompressed at most once, and only one tile is kept in
+// memory. Clients can execute parallel ReadPixels calls on the same Image.
+func (img *Image) ReadPixels(pixels []Pixel, band int, data []float32) error {
+	if len(data) != len(pixels) {
+		return fmt.Errorf("got %d samples for %d pixels", len(data), len(pixels))
+	}
+
+	type pos struct {
+		index int // index into pixels
+		tile  int // index of image tile
+		pos   int // position within image tile
+	}
+	order := make([]pos, len(pixels))
+	for i, p := range pixels {
+		if p.X >= img.Width || p.Y >= img.Height {
+			return fmt.Errorf("pixel (%d, %d) outside %dx%d image", p.X, p.Y, img.Width, img.Height)
+		}
+		tileX, tileY := p.X/img.TileWidth, p.Y/img.TileHeight
+		px, py := p.X%img.TileWidth, p.Y%img.TileHeight
+		order[i] = pos{
+			index: i,
+			tile:  int(tileY)*img.TilesAcross() + int(tileX),
+			pos:   int(py*img.TileWidth + px),
+		}
+	}
+	sort.Slice(order, func(i, j int) bool { return order[i].tile < order[j].tile })
+
+	tile := make([]float32, img.TileWidth*img.TileHeight)
+	tileIndex := -1
+	for _, p := range order {
+		if p.tile != tileIndex {
+			if err := img.ReadBand(p.tile, band, tile); err != nil {
+				return err
+			}
+			tileIndex = p.tile
+		}
+		data[p.index] = tile[p.pos]
+	}
+	return nil
+}
+
+// ReadWindow reads the samples of a band for a rectangle of pixels,
+// whose north-west corner is at pixel (x, y). The samples get stored
+// into data in row-major order. Each overlapping tile is read once.
+// Clients can execute parallel ReadWindow calls on the same Image.
+func (img *Image) ReadWindow(x, y, width, height uint32, band int, data []float32) error {
+	if uint64(x)+uint64(width) > uint64(img.Width) || uint64(y)+uint64(height) > uint64(img.Height) {
+		return fmt.Errorf("window %dx%d at (%d, %d) outside %dx%d image", width, height, x, y, img.Width, img.Height)
+	}
+	if uint64(len(data)) != uint64(width)*uint64(height) {
+		return fmt.Errorf("got %d samples for %dx%d window", len(data), width, height)
+	}
+	if width == 0 || height == 0 {
+		return nil
+	}
+
+	tw, th := img.TileWidth, img.TileHeight
+	tile := make([]float32, tw*th)
+	for tileY := y / th; tileY <= (y+height-1)/th; tileY++ {
+		for tileX := x / tw; tileX <= (x+width-1)/tw; tileX++ {
+			tileIndex := int(tileY)*img.TilesAcross() + int(tileX)
+			if err := img.ReadBand(tileIndex, band, tile); err != nil {
+				return err
+			}
+
+			// Intersect the window with the tile, in image coordinates.
+			left, right := max(x, tileX*tw), min(x+width, (tileX+1)*tw)
+			top, bottom := max(y, tileY*th), min(y+height, (tileY+1)*th)
+			for py := top; py < bottom; py++ {
+				src := tile[(py-tileY*th)*tw+(left-tileX*tw):]
+				dst := data[(py-y)*width+(left-x):]
+				copy(dst[:right-left], src)
+			}
+		}
+	}
+	return nil
+}
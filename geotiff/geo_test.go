@@ -0,0 +1,184 @@
+// SPDX-FileCopyrightText: 2026 Sascha Brawer <sascha@brawer.ch>
+// SPDX-License-Identifier: MIT
+
+package geotiff
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func openTestReader(t *testing.T) *Reader {
+	file, err := os.Open(filepath.Join("testdata", "zurich_f32.tiff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { file.Close() })
+
+	r, err := NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestReader_Georeference(t *testing.T) {
+	g := openTestReader(t).Georeference
+	if got := g.GeoKeys[geoKeyProjectedCRS]; got != 3857 {
+		t.Errorf("got ProjectedCRS=%d, want 3857", got)
+	}
+	if got := g.Tiepoint[3]; got != -20037508.34 {
+		t.Errorf("got Tiepoint[3]=%f, want -20037508.34", got)
+	}
+	if got := g.PixelScale[0] * 512; got < 40075016 || got > 40075018 {
+		t.Errorf("got PixelScale[0]*512=%f, want 40075017", got)
+	}
+}
+
+func TestGeoreference_check(t *testing.T) {
+	img := &Image{Width: 512, Height: 512}
+	good := Georeference{
+		GeoKeys:    map[uint16]uint16{geoKeyModelType: 1, geoKeyRasterType: 1, geoKeyProjectedCRS: 3857},
+		Tiepoint:   []float64{0, 0, 0, -20037508.34, 20037508.34, 0},
+		PixelScale: []float64{40075017.0 / 512, 40075017.0 / 512, 0},
+	}
+	if err := good.check(img); err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+
+	swiss := good
+	swiss.GeoKeys = map[uint16]uint16{geoKeyModelType: 1, geoKeyRasterType: 1, geoKeyProjectedCRS: 2056}
+	halfScale := good
+	halfScale.PixelScale = []float64{40075017.0 / 1024, 40075017.0 / 1024, 0}
+	for _, tc := range []struct {
+		g    Georeference
+		want string
+	}{
+		{Georeference{}, "missing GeoTIFF tags"},
+		{swiss, "got ProjectedCRS=2056, want 3857 (web mercator)"},
+		{halfScale, "image does not cover the entire world"},
+	} {
+		got := ""
+		if err := tc.g.check(img); err != nil {
+			got = err.Error()
+		}
+		if got != tc.want {
+			t.Errorf("got %q, want %q", got, tc.want)
+		}
+	}
+}
+
+func TestReader_ImageAt(t *testing.T) {
+	r := openTestReader(t)
+	for _, tc := range []struct{ zoom, want int }{
+		{255, 0},
+		{9, 0},
+		{8, 1},
+		{0, 1},
+	} {
+		if got := r.ImageAt(tc.zoom); got != r.Images[tc.want] {
+			t.Errorf("ImageAt(%d): got image with zoom %d, want Images[%d]", tc.zoom, got.Zoom(), tc.want)
+		}
+	}
+}
+
+func TestImage_PixelAt(t *testing.T) {
+	img := &Image{Width: 512, Height: 512}
+	for _, tc := range []struct {
+		lat, lng float64
+		x, y     uint32
+	}{
+		{0, 0, 256, 256},
+		{MaxLatitude, -180, 0, 0},
+		{-MaxLatitude, 180, 511, 511},
+		{89.9, -200, 0, 0},
+		{47.3769, 8.5417, 268, 179},
+	} {
+		x, y := img.PixelAt(tc.lat, tc.lng)
+		if x != tc.x || y != tc.y {
+			t.Errorf("PixelAt(%f, %f) = (%d, %d), want (%d, %d)", tc.lat, tc.lng, x, y, tc.x, tc.y)
+		}
+	}
+}
+
+func TestReader_ValueAt(t *testing.T) {
+	r := openTestReader(t)
+	for _, zoom := range []int{9, 8} {
+		got, err := r.ValueAt(47.3769, 8.5417, zoom)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		img := r.ImageAt(zoom)
+		x, y := img.PixelAt(47.3769, 8.5417)
+		data := make([]float32, img.TileWidth*img.TileHeight)
+		tile := int(y/img.TileHeight)*img.TilesAcross() + int(x/img.TileWidth)
+		if err := img.ReadTile(tile, data); err != nil {
+			t.Fatal(err)
+		}
+		want := data[(y%img.TileHeight)*img.TileWidth+x%img.TileWidth]
+		if got != want || got == 0 {
+			t.Errorf("zoom %d: got %f, want %f", zoom, got, want)
+		}
+	}
+}
+
+func TestImage_ReadWindow(t *testing.T) {
+	img := openTestReader(t).Images[0]
+	tiles := make([][]float32, 4)
+	for i := range tiles {
+		tiles[i] = make([]float32, 256*256)
+		if err := img.ReadTile(i, tiles[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The window spans the corners of all four tiles.
+	const x, y, width, height = 250, 240, 10, 30
+	data := make([]float32, width*height)
+	if err := img.ReadWindow(x, y, width, height, 0, data); err != nil {
+		t.Fatal(err)
+	}
+	for py := uint32(0); py < height; py++ {
+		for px := uint32(0); px < width; px++ {
+			ix, iy := x+px, y+py
+			want := tiles[(iy/256)*2+ix/256][(iy%256)*256+ix%256]
+			if got := data[py*width+px]; got != want {
+				t.Fatalf("pixel (%d, %d): got %f, want %f", ix, iy, got, want)
+			}
+		}
+	}
+
+	if err := img.ReadWindow(500, 0, 20, 1, 0, make([]float32, 20)); err == nil {
+		t.Error("want error for window outside image")
+	}
+	if err := img.ReadWindow(0, 0, 2, 2, 0, make([]float32, 3)); err == nil {
+		t.Error("want error for wrong number of samples")
+	}
+}
+
+func TestImage_ReadPixels(t *testing.T) {
+	img := openTestReader(t).Images[0]
+	pixels := []Pixel{{300, 10}, {0, 0}, {268, 179}, {2, 300}, {511, 511}, {268, 179}}
+	data := make([]float32, len(pixels))
+	if err := img.ReadPixels(pixels, 0, data); err != nil {
+		t.Fatal(err)
+	}
+	for i, p := range pixels {
+		var want [1]float32
+		if err := img.ReadWindow(p.X, p.Y, 1, 1, 0, want[:]); err != nil {
+			t.Fatal(err)
+		}
+		if data[i] != want[0] {
+			t.Errorf("pixel (%d, %d): got %f, want %f", p.X, p.Y, data[i], want[0])
+		}
+	}
+
+	if err := img.ReadPixels([]Pixel{{512, 0}}, 0, make([]float32, 1)); err == nil {
+		t.Error("want error for pixel outside image")
+	}
+	if err := img.ReadPixels(pixels, 0, make([]float32, 2)); err == nil {
+		t.Error("want error for wrong number of samples")
+	}
+}
@@ -0,0 +1,276 @@
+// SPDX-FileCopyrightText: 2026 Sascha Brawer <sascha@brawer.ch>
+// SPDX-License-Identifier: MIT
+
+package geotiff
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// DecodeLerc decompresses a Lerc2 blob of float32 samples, as written
+// by our pipeline for TIFF compression 34887. For tiles with several
+// bands, the samples of each pixel get interleaved. We only support
+// the features that our own encoder uses, which are versions 3 and 4
+// of the blob format without validity masks or lookup tables.
+// https://github.com/Esri/lerc/blob/master/doc/LercCodecSpec.md
+func decodeLerc(blob []byte, width, height, bands int, samples []float32) error {
+	le := binary.LittleEndian
+	if len(samples) != width*height*bands {
+		return fmt.Errorf("got %d samples, want %d", len(samples), width*height*bands)
+	}
+	if len(blob) < 14 || string(blob[:6]) != "Lerc2 " {
+		return fmt.Errorf("not a Lerc2 blob")
+	}
+	version := int(le.Uint32(blob[6:]))
+	if version != 3 && version != 4 {
+		return fmt.Errorf("unsupported Lerc2 version %d", version)
+	}
+
+	d := &lercDecoder{buf: blob[14:]}
+	rows, cols, nDim := int(d.uint32()), int(d.uint32()), 1
+	if version >= 4 {
+		nDim = int(d.uint32())
+	}
+	numValid, blockSize, blobSize, dataType := int(d.uint32()), int(d.uint32()), int(d.uint32()), int(d.uint32())
+	maxError, zMin, zMax := d.float64(), d.float64(), d.float64()
+	if d.err != nil {
+		return d.err
+	}
+	start := len(blob) - len(d.buf)
+	if blobSize > len(blob) || blobSize < start {
+		return fmt.Errorf("truncated Lerc2 blob")
+	}
+	if lercChecksum(blob[14:blobSize]) != le.Uint32(blob[10:]) {
+		return fmt.Errorf("Lerc2 checksum mismatch")
+	}
+	d.buf = blob[start:blobSize]
+	if rows != height || cols != width || nDim != bands {
+		return fmt.Errorf("got Lerc2 blob of %dx%dx%d samples, want %dx%dx%d", cols, rows, nDim, width, height, bands)
+	}
+	if dataType != 6 {
+		return fmt.Errorf("unsupported Lerc2 data type %d", dataType)
+	}
+	if numValid != width*height {
+		return fmt.Errorf("Lerc2 validity masks are not supported")
+	}
+	if blockSize <= 0 {
+		return fmt.Errorf("bad Lerc2 block size %d", blockSize)
+	}
+
+	d.uint32() // size of validity mask, which is empty
+	if zMin == zMax {
+		for i := range samples {
+			samples[i] = float32(zMin)
+		}
+		return d.err
+	}
+
+	zMaxs := make([]float64, bands)
+	for i := range zMaxs {
+		zMaxs[i] = zMax
+	}
+	if version >= 4 {
+		mins := make([]float32, bands)
+		constant := true
+		for i := range mins {
+			mins[i] = d.float32()
+		}
+		for i := range zMaxs {
+			m := d.float32()
+			zMaxs[i] = float64(m)
+			constant = constant && mins[i] == m
+		}
+		if constant {
+			for i := range samples {
+				samples[i] = mins[i%bands]
+			}
+			return d.err
+		}
+	}
+
+	if oneSweep := d.byte(); oneSweep != 0 {
+		for i := range samples {
+			samples[i] = d.float32()
+		}
+		return d.err
+	}
+
+	scale := 2 * maxError
+	for y0 := 0; y0 < height; y0 += blockSize {
+		y1 := min(y0+blockSize, height)
+		for x0 := 0; x0 < width; x0 += blockSize {
+			x1 := min(x0+blockSize, width)
+			n := (y1 - y0) * (x1 - x0)
+			for band := range bands {
+				block, err := d.block(n, x0, scale, zMaxs[band])
+				if err != nil {
+					return err
+				}
+				i := 0
+				for y := y0; y < y1; y++ {
+					for x := x0; x < x1; x++ {
+						samples[(y*width+x)*bands+band] = block[i]
+						i++
+					}
+				}
+			}
+		}
+	}
+	return d.err
+}
+
+// LercDecoder reads the parts of a Lerc2 blob. Reading beyond the end
+// of the blob sets err, and then returns zeros.
+type lercDecoder struct {
+	buf []byte
+	err error
+}
+
+func (d *lercDecoder) next(n int) []byte {
+	if d.err != nil || len(d.buf) < n {
+		d.err = fmt.Errorf("truncated Lerc2 blob")
+		return make([]byte, n)
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *lercDecoder) byte() byte {
+	return d.next(1)[0]
+}
+
+func (d *lercDecoder) uint32() uint32 {
+	return binary.LittleEndian.Uint32(d.next(4))
+}
+
+func (d *lercDecoder) float32() float32 {
+	return math.Float32frombits(d.uint32())
+}
+
+func (d *lercDecoder) float64() float64 {
+	return math.Float64frombits(binary.LittleEndian.Uint64(d.next(8)))
+}
+
+// Block decodes the n samples of one band in a block whose left
+// column is x0. Quantized samples are offset+q*scale, clamped to zMax.
+func (d *lercDecoder) block(n, x0 int, scale, zMax float64) ([]float32, error) {
+	flags := d.byte()
+	if int(flags>>2&15) != x0>>3&15 {
+		return nil, fmt.Errorf("corrupt Lerc2 block at column %d", x0)
+	}
+	block := make([]float32, n)
+	switch flags & 3 {
+	case 0: // raw samples
+		for i := range block {
+			block[i] = d.float32()
+		}
+		return block, d.err
+	case 2: // all zero
+		return block, d.err
+	}
+
+	// The offset is stored as float32, int16 or uint8, telling
+	// by bits 6 and 7.
+	var offset float64
+	switch flags >> 6 {
+	case 0:
+		offset = float64(d.float32())
+	case 1:
+		offset = float64(int16(binary.LittleEndian.Uint16(d.next(2))))
+	case 2:
+		offset = float64(d.byte())
+	default:
+		return nil, fmt.Errorf("bad Lerc2 offset type")
+	}
+	if flags&3 == 3 { // constant
+		for i := range block {
+			block[i] = float32(offset)
+		}
+		return block, d.err
+	}
+
+	quantized, err := d.bitStuffed(n)
+	if err != nil {
+		return nil, err
+	}
+	for i, q := range quantized {
+		block[i] = float32(min(offset+float64(q)*scale, zMax))
+	}
+	return block, nil
+}
+
+// BitStuffed decodes n unsigned integers that have been packed
+// into little-endian 32-bit words, starting at the lowest bit.
+func (d *lercDecoder) bitStuffed(n int) ([]uint32, error) {
+	head := d.byte()
+	numBits := int(head & 31)
+	if head&32 != 0 {
+		return nil, fmt.Errorf("Lerc2 lookup tables are not supported")
+	}
+	var count int
+	switch head >> 6 {
+	case 0:
+		count = int(d.uint32())
+	case 1:
+		count = int(binary.LittleEndian.Uint16(d.next(2)))
+	case 2:
+		count = int(d.byte())
+	default:
+		return nil, fmt.Errorf("bad Lerc2 element count")
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if count != n {
+		return nil, fmt.Errorf("got %d Lerc2 elements, want %d", count, n)
+	}
+
+	values := make([]uint32, n)
+	if numBits == 0 {
+		return values, nil
+	}
+	data := d.next((n*numBits + 7) / 8)
+	if d.err != nil {
+		return nil, d.err
+	}
+	mask := uint32(1)<<numBits - 1
+	pos := 0
+	for i := range values {
+		// A value of up to 31 bits, starting at any bit of a byte,
+		// spans at most five bytes.
+		var v uint64
+		for b := pos / 8; b < min(pos/8+5, len(data)); b++ {
+			v |= uint64(data[b]) << (8 * (b - pos/8))
+		}
+		values[i] = uint32(v>>(pos%8)) & mask
+		pos += numBits
+	}
+	return values, nil
+}
+
+// LercChecksum computes the Fletcher-32 checksum of a Lerc2 blob,
+// starting right after the checksum field of the header.
+func lercChecksum(data []byte) uint32 {
+	sum1, sum2 := uint32(0xffff), uint32(0xffff)
+	for len(data) >= 2 {
+		// Reduce the sums often enough that they cannot overflow.
+		n := min(len(data)/2, 359)
+		for i := 0; i < n; i++ {
+			sum1 += uint32(data[2*i])<<8 | uint32(data[2*i+1])
+			sum2 += sum1
+		}
+		data = data[2*n:]
+		sum1 = sum1&0xffff + sum1>>16
+		sum2 = sum2&0xffff + sum2>>16
+	}
+	if len(data) == 1 {
+		sum1 += uint32(data[0]) << 8
+		sum2 += sum1
+	}
+	sum1 = sum1&0xffff + sum1>>16
+	sum2 = sum2&0xffff + sum2>>16
+	return sum2<<16 | sum1
+}
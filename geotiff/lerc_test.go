@@ -0,0 +1,50 @@
+// SPDX-FileCopyrightText: 2026 Sascha Brawer <sascha@brawer.ch>
+// SPDX-License-Identifier: MIT
+
+package geotiff
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The test blobs were encoded by the reference implementation
+// of Esri’s LERC library with a maximum error of 0.01.
+func TestDecodeLerc(t *testing.T) {
+	const width, height = 19, 13
+	for _, tc := range []struct {
+		file  string
+		bands int
+	}{
+		{"lerc_v3.lerc2", 1},
+		{"lerc_v4.lerc2", 2},
+	} {
+		blob, err := os.ReadFile(filepath.Join("testdata", tc.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		samples := make([]float32, width*height*tc.bands)
+		if err := decodeLerc(blob, width, height, tc.bands, samples); err != nil {
+			t.Fatalf("%s: %v", tc.file, err)
+		}
+		for i, got := range samples {
+			want := 0.0
+			if (i/tc.bands)%23 != 0 {
+				want = math.Sin(float64(i)*0.37)*5 + float64(i%tc.bands)*100
+			}
+			if math.Abs(float64(got)-want) > 0.01 {
+				t.Errorf("%s: sample %d: got %f, want %f", tc.file, i, got, want)
+			}
+		}
+
+		if err := decodeLerc(blob, width+1, height, tc.bands, make([]float32, (width+1)*height*tc.bands)); err == nil {
+			t.Errorf("%s: want error for wrong width", tc.file)
+		}
+		blob[len(blob)-1] ^= 0xff
+		if err := decodeLerc(blob, width, height, tc.bands, samples); err == nil {
+			t.Errorf("%s: want error for checksum mismatch", tc.file)
+		}
+	}
+}
@@ -0,0 +1,474 @@
+// SPDX-FileCopyrightText: 2025 Sascha Brawer <sascha@brawer.ch>
+// SPDX-License-Identifier: MIT
+
+// Package geotiff reads the Cloud-Optimized GeoTIFF files produced
+// by the OSMViews pipeline. It is shared between the pipeline, which
+// reads back its own output for computing statistics, and the webserver,
+// which answers queries about the published data.
+package geotiff
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ZstdDecoder is shared by all readers; its DecodeAll method
+// can be called concurrently.
+var zstdDecoder, _ = zstd.NewReader(nil)
+
+// Reader can read TIFF images produced by our own pipeline.
+// It is not a general reader for arbitrary image files from other programs.
+type Reader struct {
+	r     io.ReaderAt
+	order binary.ByteOrder
+
+	// BigTIFF is true if the file is in the BigTIFF format,
+	// which uses 8-byte offsets so files can exceed 4 GiB.
+	BigTIFF bool
+
+	// Georeference tells where the main image is located on Earth.
+	Georeference Georeference
+
+	// Images contains the main image, followed by its overviews
+	// in order of decreasing resolution.
+	Images []*Image
+}
+
+// Image is a single Image File Directory (IFD) in a TIFF file.
+// In our GeoTIFFs, the first image is the main image at full resolution;
+// each following image is an overview at half the previous resolution.
+type Image struct {
+	reader                *Reader
+	Offset                int64 // of the Image File Directory
+	Width, Height         uint32
+	TileWidth, TileHeight uint32
+	TileOffsets           []uint64
+	TileByteCounts        []uint32
+	SamplesPerPixel       uint32
+	Compression           uint32  // 8 = zlib, 50000 = zstd, 34887 = LERC
+	Predictor             uint32  // 1 = none, 3 = floating point
+	MaxValue              float32 // of the first band
+}
+
+func NewReader(r io.ReaderAt) (*Reader, error) {
+	tr := &Reader{r: r}
+	if err := tr.readIFDs(); err != nil {
+		return nil, err
+	}
+	return tr, nil
+}
+
+// ReadIFDs reads all Image File Directories (IFDs) in the TIFF file.
+func (t *Reader) readIFDs() error {
+	var header [16]byte
+	if _, err := t.r.ReadAt(header[:8], 0); err != nil {
+		return err
+	}
+
+	switch {
+	case bytes.Equal(header[:2], []byte{'I', 'I'}):
+		t.order = binary.LittleEndian
+	case bytes.Equal(header[:2], []byte{'M', 'M'}):
+		t.order = binary.BigEndian
+	default:
+		return fmt.Errorf("unsupported format")
+	}
+
+	var ifdOffset int64
+	switch t.order.Uint16(header[2:4]) {
+	case 42:
+		ifdOffset = int64(t.order.Uint32(header[4:8]))
+
+	case 43:
+		// BigTIFF has 8-byte offsets, announced in the header.
+		// https://www.awaresystems.be/imaging/tiff/bigtiff.html
+		if t.order.Uint16(header[4:6]) != 8 || t.order.Uint16(header[6:8]) != 0 {
+			return fmt.Errorf("unsupported BigTIFF offset size")
+		}
+		if _, err := t.r.ReadAt(header[8:16], 8); err != nil {
+			return err
+		}
+		t.BigTIFF = true
+		ifdOffset = int64(t.order.Uint64(header[8:16]))
+
+	default:
+		return fmt.Errorf("unsupported format")
+	}
+
+	// To protect against malformed input, we limit the number of
+	// IFDs. Our own output has one IFD per zoom level.
+	for ifdOffset != 0 {
+		if len(t.Images) >= 32 {
+			return fmt.Errorf("too many image file directories")
+		}
+		img, next, err := t.readIFD(ifdOffset)
+		if err != nil {
+			return err
+		}
+		t.Images = append(t.Images, img)
+		ifdOffset = next
+	}
+
+	if len(t.Images) == 0 {
+		return fmt.Errorf("no images in TIFF file")
+	}
+
+	return t.Georeference.check(t.Images[0])
+}
+
+// ReadOffset decodes a file offset, or an entry count,
+// of the size used in the TIFF file.
+func (t *Reader) readOffset(b []byte) uint64 {
+	if t.BigTIFF {
+		return t.order.Uint64(b)
+	}
+	return uint64(t.order.Uint32(b))
+}
+
+// ReadIFD reads the Image File Directory (IFD) starting at ifdOffset.
+// It returns the parsed image, and the offset to the next IFD.
+func (t *Reader) readIFD(ifdOffset int64) (*Image, int64, error) {
+	// In classic TIFF, an IFD has a 2-byte entry count, 12-byte entries
+	// and a 4-byte offset to the next IFD. In BigTIFF, these are 8 bytes,
+	// 20 bytes and 8 bytes.
+	countSize, entrySize, valueSize := int64(2), int64(12), int64(4)
+	if t.BigTIFF {
+		countSize, entrySize, valueSize = 8, 20, 8
+	}
+
+	var numDirEntries uint64
+	if t.BigTIFF {
+		var buf [8]byte
+		if _, err := t.r.ReadAt(buf[:], ifdOffset); err != nil {
+			return nil, 0, err
+		}
+		numDirEntries = t.order.Uint64(buf[:])
+	} else {
+		n, err := t.readUint16(ifdOffset)
+		if err != nil {
+			return nil, 0, err
+		}
+		numDirEntries = uint64(n)
+	}
+	if numDirEntries > 0xffff {
+		return nil, 0, fmt.Errorf("image at offset %d has too many entries", ifdOffset)
+	}
+
+	ifdSize := int64(numDirEntries)*entrySize + valueSize
+	ifd := make([]byte, ifdSize)
+	if _, err := t.r.ReadAt(ifd, ifdOffset+countSize); err != nil {
+		return nil, 0, err
+	}
+
+	img := &Image{reader: t, Offset: ifdOffset, SamplesPerPixel: 1, Predictor: 1, Compression: 8}
+	for i := int64(0); i < int64(numDirEntries); i++ {
+		entry := ifd[i*entrySize : (i+1)*entrySize]
+		tag := t.order.Uint16(entry[0:2])
+		typ := t.order.Uint16(entry[2:4])
+		count := t.readOffset(entry[4 : 4+valueSize])
+		field := entry[4+valueSize:]
+
+		var value uint32
+		var floatValue float32
+		switch typ {
+		case 3: // SHORT
+			value = uint32(t.order.Uint16(field))
+
+		case 4: // LONG
+			value = t.order.Uint32(field)
+
+		case 11: // FLOAT
+			// For multi-band images, the values of all bands are stored
+			// outside the IFD entry; we only need the first one.
+			if count*4 <= uint64(valueSize) {
+				floatValue = math.Float32frombits(t.order.Uint32(field))
+			} else {
+				offset := int64(t.readOffset(field))
+				reader := io.NewSectionReader(t.r, offset, 4)
+				if err := binary.Read(reader, t.order, &floatValue); err != nil {
+					return nil, 0, err
+				}
+			}
+		}
+
+		switch tag {
+		case 256: // ImageWidth
+			img.Width = value
+
+		case 257: // ImageLength
+			img.Height = value
+
+		case 322: // TileWidth
+			img.TileWidth = value
+
+		case 323: // TileLength
+			img.TileHeight = value
+
+		case 259: // Compression
+			img.Compression = value
+
+		case 277: // SamplesPerPixel
+			img.SamplesPerPixel = value
+
+		case 317: // Predictor
+			img.Predictor = value
+
+		case 324: // TileOffsets
+			if a, err := t.readIntArray(typ, count, field); err == nil {
+				img.TileOffsets = a
+			} else {
+				return nil, 0, err
+			}
+
+		case 325: // TileByteCounts
+			a, err := t.readIntArray(typ, count, field)
+			if err != nil {
+				return nil, 0, err
+			}
+			img.TileByteCounts = make([]uint32, len(a))
+			for i, n := range a {
+				if n > math.MaxUint32 {
+					return nil, 0, fmt.Errorf("image at offset %d has tile of %d bytes", ifdOffset, n)
+				}
+				img.TileByteCounts[i] = uint32(n)
+			}
+
+		case 341: // sMaxSampleValue
+			img.MaxValue = floatValue
+
+		case 33550, 33922, 34735: // ModelPixelScale, ModelTiepoint, GeoKeyDirectory
+			// Overviews have no georeference of their own.
+			if len(t.Images) == 0 {
+				if err := t.readGeoTag(tag, typ, count, field); err != nil {
+					return nil, 0, err
+				}
+			}
+		}
+	}
+
+	next := int64(t.readOffset(ifd[ifdSize-valueSize:]))
+
+	if img.SamplesPerPixel == 0 || img.SamplesPerPixel > 16 {
+		return nil, 0, fmt.Errorf("image at offset %d has unsupported SamplesPerPixel=%d", ifdOffset, img.SamplesPerPixel)
+	}
+	if img.Compression != 8 && img.Compression != 50000 && img.Compression != 34887 {
+		return nil, 0, fmt.Errorf("image at offset %d has unsupported Compression=%d", ifdOffset, img.Compression)
+	}
+	if img.Predictor != 1 && img.Predictor != 3 {
+		return nil, 0, fmt.Errorf("image at offset %d has unsupported Predictor=%d", ifdOffset, img.Predictor)
+	}
+	if img.TileWidth == 0 || img.TileHeight == 0 {
+		return nil, 0, fmt.Errorf("image at offset %d is not tiled", ifdOffset)
+	}
+	if len(img.TileOffsets) != len(img.TileByteCounts) {
+		return nil, 0, fmt.Errorf("image at offset %d has %d TileOffsets but %d TileByteCounts", ifdOffset, len(img.TileOffsets), len(img.TileByteCounts))
+	}
+	if len(img.TileOffsets) != img.TilesAcross()*img.TilesDown() {
+		return nil, 0, fmt.Errorf("image at offset %d has %d tiles, want %d", ifdOffset, len(img.TileOffsets), img.TilesAcross()*img.TilesDown())
+	}
+
+	return img, next, nil
+}
+
+// ReadUInt16 reads an unsigned 16-bit integer from the TIFF file,
+// starting at pos.
+func (t *Reader) readUint16(pos int64) (uint16, error) {
+	var buf [2]byte
+	n, err := t.r.ReadAt(buf[:], pos)
+	if err != nil {
+		return 0, err
+	}
+	if n != 2 {
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	num := t.order.Uint16(buf[:])
+	return num, nil
+}
+
+// ReadEntry returns the encoded values of an Image File Directory entry,
+// given its type, count and value field. Values that fit into the value
+// field are stored inline; others are stored elsewhere in the file.
+func (t *Reader) readEntry(typ uint16, count uint64, field []byte) ([]byte, error) {
+	var size uint64
+	switch typ {
+	case 1, 2: // BYTE, ASCII
+		size = 1
+	case 3: // SHORT
+		size = 2
+	case 4, 11: // LONG, FLOAT
+		size = 4
+	case 12, 16: // DOUBLE, LONG8
+		size = 8
+	default:
+		return nil, fmt.Errorf("unsupported type=%d", typ)
+	}
+
+	// Our images have at most 4^(20-8) tiles, which is far below this
+	// limit. Checking it protects against huge allocations for malformed
+	// input.
+	if count > 1<<25 {
+		return nil, fmt.Errorf("array with %d elements is too large", count)
+	}
+
+	if count*size <= uint64(len(field)) {
+		return field[:count*size], nil
+	}
+	data := make([]byte, count*size)
+	if _, err := t.r.ReadAt(data, int64(t.readOffset(field))); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// ReadIntArray reads an array of LONG or LONG8 integers into memory,
+// given the value field of its Image File Directory entry. This is used
+// internally for reading TileOffsets and TileByteCounts.
+func (t *Reader) readIntArray(typ uint16, count uint64, field []byte) ([]uint64, error) {
+	if typ != 4 && typ != 16 {
+		return nil, fmt.Errorf("got type=%d, want 4 or 16", typ)
+	}
+
+	data, err := t.readEntry(typ, count, field)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]uint64, count)
+	for i := range result {
+		if typ == 16 {
+			result[i] = t.order.Uint64(data[8*i:])
+		} else {
+			result[i] = uint64(t.order.Uint32(data[4*i:]))
+		}
+	}
+	return result, nil
+}
+
+// TilesAcross returns the number of tile columns in the image.
+func (img *Image) TilesAcross() int {
+	return int((img.Width + img.TileWidth - 1) / img.TileWidth)
+}
+
+// TilesDown returns the number of tile rows in the image.
+func (img *Image) TilesDown() int {
+	return int((img.Height + img.TileHeight - 1) / img.TileHeight)
+}
+
+// Zoom returns the zoom level of an image’s pixels. In our GeoTIFFs,
+// images cover the entire world in web mercator projection, so
+// a pixel at zoom level z is the same area as a web mercator tile
+// at zoom z.
+func (img *Image) Zoom() uint8 {
+	return uint8(bits.Len32(img.Width) - 1)
+}
+
+// ReadTile reads a single image tile into memory. For images with
+// several bands, the samples of each pixel are interleaved.
+// Clients can execute parallel ReadTile calls on the same Image.
+func (img *Image) ReadTile(tileIndex int, data any) error {
+	if tileIndex < 0 || tileIndex >= len(img.TileOffsets) {
+		return fmt.Errorf("tile index %d out of range", tileIndex)
+	}
+
+	t := img.reader
+	tileOffset := int64(img.TileOffsets[tileIndex])
+	tileSize := int64(img.TileByteCounts[tileIndex])
+	tileReader := io.NewSectionReader(t.r, tileOffset, tileSize)
+	var reader io.Reader
+	if img.Compression == 34887 {
+		// LERC works on samples, not bytes, so it needs no predictor.
+		samples, ok := data.([]float32)
+		if !ok {
+			return fmt.Errorf("LERC compression needs []float32, got %T", data)
+		}
+		blob := make([]byte, tileSize)
+		if _, err := io.ReadFull(tileReader, blob); err != nil {
+			return err
+		}
+		return decodeLerc(blob, int(img.TileWidth), int(img.TileHeight), int(img.SamplesPerPixel), samples)
+	} else if img.Compression == 50000 {
+		compressed := make([]byte, tileSize)
+		if _, err := io.ReadFull(tileReader, compressed); err != nil {
+			return err
+		}
+		decompressed, err := zstdDecoder.DecodeAll(compressed, nil)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(decompressed)
+	} else {
+		zlibReader, err := zlib.NewReader(tileReader)
+		if err != nil {
+			return err
+		}
+		reader = zlibReader
+	}
+
+	if img.Predictor == 1 {
+		return binary.Read(reader, t.order, data)
+	}
+
+	samples, ok := data.([]float32)
+	if !ok {
+		return fmt.Errorf("floating-point predictor needs []float32, got %T", data)
+	}
+	spp := int(img.SamplesPerPixel)
+	if len(samples)%(int(img.TileWidth)*spp) != 0 {
+		return fmt.Errorf("got %d samples, want whole rows of %d", len(samples), int(img.TileWidth)*spp)
+	}
+	buf := make([]byte, 4*len(samples))
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		return err
+	}
+	unpredictFloats(buf, samples, int(img.TileWidth)*spp, spp)
+	return nil
+}
+
+// UnpredictFloats reverses the TIFF floating-point predictor, which
+// groups the bytes of each row by significance and then stores the
+// difference of each byte to the byte one pixel earlier.
+// https://chriscox.org/TIFFTN3d1.pdf
+func unpredictFloats(buf []byte, samples []float32, rowSamples int, stride int) {
+	for start := 0; start < len(samples); start += rowSamples {
+		row := buf[4*start : 4*(start+rowSamples)]
+		for i := stride; i < len(row); i++ {
+			row[i] += row[i-stride]
+		}
+		for i := range rowSamples {
+			bits := uint32(row[i])<<24 | uint32(row[rowSamples+i])<<16 |
+				uint32(row[2*rowSamples+i])<<8 | uint32(row[3*rowSamples+i])
+			samples[start+i] = math.Float32frombits(bits)
+		}
+	}
+}
+
+// ReadBand reads one band of a single image tile into memory.
+// In our GeoTIFFs, band 0 is the view density; the other bands,
+// if present, hold auxiliary data about the same pixels.
+// Clients can execute parallel ReadBand calls on the same Image.
+func (img *Image) ReadBand(tileIndex int, band int, data []float32) error {
+	spp := int(img.SamplesPerPixel)
+	if band < 0 || band >= spp {
+		return fmt.Errorf("band %d out of range", band)
+	}
+	if spp == 1 {
+		return img.ReadTile(tileIndex, data)
+	}
+
+	samples := make([]float32, len(data)*spp)
+	if err := img.ReadTile(tileIndex, samples); err != nil {
+		return err
+	}
+	for i := range data {
+		data[i] = samples[i*spp+band]
+	}
+	return nil
+}
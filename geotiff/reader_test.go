@@ -0,0 +1,101 @@
+// SPDX-FileCopyrightText: 2025 Sascha Brawer <sascha@brawer.ch>
+// SPDX-License-Identifier: MIT
+
+package geotiff
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReader(t *testing.T) {
+	file, err := os.Open(filepath.Join("testdata", "zurich_f32.tiff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	r, err := NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r.Images) != 2 {
+		t.Fatalf("got %d images, want 2", len(r.Images))
+	}
+
+	img := r.Images[0]
+	if img.Width != 512 || img.Height != 512 {
+		t.Errorf("got Width=%d Height=%d", img.Width, img.Height)
+	}
+
+	if img.TileWidth != 256 || img.TileHeight != 256 {
+		t.Errorf("got TileWidth=%d TileHeight=%d", img.TileWidth, img.TileHeight)
+	}
+
+	numTiles := len(img.TileOffsets)
+	if numTiles != 4 {
+		t.Errorf("got %d tiles", numTiles)
+	}
+
+	if len(img.TileOffsets) != len(img.TileByteCounts) {
+		t.Error("len(TileOffsets) should equal len(TileByteCounts")
+	}
+
+	if img.MaxValue < 0.07098 || img.MaxValue > 0.07099 {
+		t.Errorf("got MaxValue=%f", img.MaxValue)
+	}
+
+	if got := img.Zoom(); got != 9 {
+		t.Errorf("got Zoom()=%d, want 9", got)
+	}
+
+	data := make([]float32, img.TileWidth*img.TileHeight)
+	if err := img.ReadTile(1, data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReader_Overview(t *testing.T) {
+	file, err := os.Open(filepath.Join("testdata", "zurich_f32.tiff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	r, err := NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The overview has a single tile, whose offset and byte count
+	// are stored inline in the Image File Directory.
+	img := r.Images[1]
+	if img.Width != 256 || img.Height != 256 || img.Zoom() != 8 {
+		t.Errorf("got Width=%d Height=%d Zoom()=%d", img.Width, img.Height, img.Zoom())
+	}
+
+	if len(img.TileOffsets) != 1 || len(img.TileByteCounts) != 1 {
+		t.Fatalf("got TileOffsets=%v TileByteCounts=%v", img.TileOffsets, img.TileByteCounts)
+	}
+
+	data := make([]float32, img.TileWidth*img.TileHeight)
+	if err := img.ReadTile(0, data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnpredictFloats(t *testing.T) {
+	buf := []byte{
+		0x3f, 0x00, 0x41, 0x40, 0x40, 0x00, 0x00, 0x00,
+		0x3f, 0x00, 0x41, 0x40, 0x40, 0x00, 0x00, 0x00,
+	}
+	got := make([]float32, 4)
+	unpredictFloats(buf, got, 2, 1)
+	want := []float32{1.0, 1.5, 1.0, 1.5}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -10,6 +10,7 @@ go 1.24.2
 require (
 	github.com/andybalholm/brotli v1.1.1
 	github.com/fogleman/gg v1.3.0
+	github.com/klauspost/compress v1.18.0
 	github.com/lanrat/extsort v1.0.2
 	github.com/minio/minio-go/v7 v7.0.91
 	github.com/orcaman/writerseeker v0.0.0-20200621085525-1d3f536ff85e
@@ -26,7 +27,6 @@ require (
 	github.com/goccy/go-json v0.10.5 // indirect
 	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0 // indirect
 	github.com/google/uuid v1.6.0 // indirect
-	github.com/klauspost/compress v1.18.0 // indirect
 	github.com/klauspost/cpuid/v2 v2.2.10 // indirect
 	github.com/minio/crc64nvme v1.0.2 // indirect
 	github.com/minio/md5-simd v1.1.2 // indirect